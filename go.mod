@@ -5,7 +5,6 @@ go 1.25
 require (
 	cattlecloud.net/go/scope v1.2.1
 	github.com/golang-jwt/jwt/v5 v5.3.1
-	github.com/hashicorp/go-set/v3 v3.0.1
 	github.com/mileusna/useragent v1.3.5
 	github.com/shoenig/go-conceal v0.5.4
 	github.com/shoenig/test v1.12.2
@@ -0,0 +1,224 @@
+package middles
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"html"
+	"html/template"
+	"net/http"
+
+	"cattlecloud.net/go/webtools/middles/identity"
+	"github.com/shoenig/go-conceal"
+)
+
+const (
+	// DefaultCSRFCookieName is the name of the double-submit cookie set for
+	// anonymous sessions if CSRF.CookieName is not set.
+	DefaultCSRFCookieName = "csrf"
+
+	// DefaultCSRFFieldName is the name of the form field containing the token
+	// if CSRF.FieldName is not set.
+	DefaultCSRFFieldName = "csrf_token"
+
+	// DefaultCSRFHeaderName is the name of the request header containing the
+	// token if CSRF.HeaderName is not set.
+	DefaultCSRFHeaderName = "X-CSRF-Token"
+)
+
+// CSRF is an http.Handler which protects unsafe requests (e.g. POST) with a
+// synchronizer token, for use where http.CrossOriginProtection is not enough
+// because the Sec-Fetch-Site and Origin headers may be stripped by a proxy.
+//
+// CSRF must be wrapped by SetSession, so that tokens can be bound to the
+// session identity and session token. Requests without an active session fall
+// back to a double-submit cookie.
+//
+// Tokens are embedded in pages by using CSRFToken or CSRFField, and are
+// expected back on unsafe requests in either the form field or the header.
+type CSRF[I identity.UserIdentity] struct {
+	Key        *conceal.Bytes
+	CookieName string
+	FieldName  string
+	HeaderName string
+	Secure     bool
+	Next       http.Handler
+
+	// Reject is called when an unsafe request is missing a valid token. If not
+	// set, a plain 403 Forbidden response is written.
+	Reject http.Handler
+}
+
+func (c *CSRF[I]) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	binding, ok := c.bind(r)
+	if !ok {
+		// no active session and no double-submit cookie; mint a new cookie
+		// which will be used on subsequent requests
+		value := random(32)
+		http.SetCookie(w, &http.Cookie{
+			Name:     c.cookieName(),
+			Value:    value,
+			Path:     "/",
+			HttpOnly: true,
+			SameSite: http.SameSiteLaxMode,
+			Secure:   c.Secure,
+		})
+		binding = "anonymous:" + value
+	}
+
+	state := &csrfState{
+		key:     c.Key,
+		binding: binding,
+		field:   c.fieldName(),
+	}
+	ctx2 := context.WithValue(r.Context(), csrfContextKey, state)
+	r2 := r.WithContext(ctx2)
+
+	if !safeMethod(r.Method) {
+		proposal := r2.Header.Get(c.headerName())
+		if proposal == "" {
+			proposal = r2.PostFormValue(state.field)
+		}
+
+		// a freshly minted cookie can never validate, which is intended
+		if !ok || !state.verify(proposal) {
+			c.reject(w, r2)
+			return
+		}
+	}
+
+	c.Next.ServeHTTP(w, r2)
+}
+
+// bind returns the value CSRF tokens of r are bound to, which is either the
+// identity and token of the active session, or the value of the double-submit
+// cookie for anonymous requests.
+func (c *CSRF[I]) bind(r *http.Request) (string, bool) {
+	if s, ok := GetSession[I](r).(*session[I]); ok && s.active && s.token != nil {
+		id, err := json.Marshal(s.id)
+		if err == nil {
+			return "session:" + string(id) + ":" + s.token.Unveil(), true
+		}
+	}
+
+	cookie, err := r.Cookie(c.cookieName())
+	if err != nil || cookie.Value == "" {
+		return "", false
+	}
+
+	return "anonymous:" + cookie.Value, true
+}
+
+func (c *CSRF[I]) reject(w http.ResponseWriter, r *http.Request) {
+	if c.Reject != nil {
+		c.Reject.ServeHTTP(w, r)
+		return
+	}
+	http.Error(w, "csrf token not valid", http.StatusForbidden)
+}
+
+func (c *CSRF[I]) cookieName() string {
+	if c.CookieName == "" {
+		return DefaultCSRFCookieName
+	}
+	return c.CookieName
+}
+
+func (c *CSRF[I]) fieldName() string {
+	if c.FieldName == "" {
+		return DefaultCSRFFieldName
+	}
+	return c.FieldName
+}
+
+func (c *CSRF[I]) headerName() string {
+	if c.HeaderName == "" {
+		return DefaultCSRFHeaderName
+	}
+	return c.HeaderName
+}
+
+// CSRFToken returns a token for embedding into the page rendered for r, which
+// must have passed through the CSRF handler.
+//
+// Each call returns a different token (to avoid leaking the same bytes in every
+// compressed response), all of which are valid for the session.
+//
+// If r did not pass through the CSRF handler, an empty string is returned.
+func CSRFToken(r *http.Request) string {
+	state, ok := r.Context().Value(csrfContextKey).(*csrfState)
+	if !ok {
+		return ""
+	}
+	return state.mint()
+}
+
+// CSRFField returns a hidden HTML form input element containing a token from
+// CSRFToken, for use in html/template forms; e.g.
+//
+//	<form method="POST">{{ .CSRF }} ... </form>
+func CSRFField(r *http.Request) template.HTML {
+	state, ok := r.Context().Value(csrfContextKey).(*csrfState)
+	if !ok {
+		return ""
+	}
+	return template.HTML(`<input type="hidden" name="` + html.EscapeString(state.field) +
+		`" value="` + html.EscapeString(state.mint()) + `">`)
+}
+
+type csrfKey struct{}
+
+var csrfContextKey = csrfKey{}
+
+// csrfState is stored in the request context by the CSRF handler, enabling
+// tokens to be minted during page rendering.
+type csrfState struct {
+	key     *conceal.Bytes
+	binding string
+	field   string
+}
+
+const saltSize = 16
+
+func (s *csrfState) mint() string {
+	token := make([]byte, saltSize, saltSize+sha256.Size)
+	_, _ = rand.Read(token)
+	token = append(token, s.sign(token)...)
+	return base64.RawURLEncoding.EncodeToString(token)
+}
+
+func (s *csrfState) verify(proposal string) bool {
+	token, err := base64.RawURLEncoding.DecodeString(proposal)
+	if err != nil || len(token) != saltSize+sha256.Size {
+		return false
+	}
+	salt, mac := token[:saltSize], token[saltSize:]
+	return hmac.Equal(mac, s.sign(salt))
+}
+
+func (s *csrfState) sign(salt []byte) []byte {
+	h := hmac.New(sha256.New, s.key.Unveil())
+	_, _ = h.Write(salt)
+	_, _ = h.Write([]byte(s.binding))
+	return h.Sum(nil)
+}
+
+// safeMethod returns whether method is safe according to RFC 9110, and thus
+// does not require CSRF protection.
+func safeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	default:
+		return false
+	}
+}
+
+func random(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -0,0 +1,167 @@
+package middles
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shoenig/go-conceal"
+	"github.com/shoenig/test/must"
+)
+
+type testData struct {
+	UserID    int    `json:"user_id"`
+	UserToken string `json:"token"`
+}
+
+func (td *testData) Identity() int        { return td.UserID }
+func (td *testData) Token() *conceal.Text { return conceal.New(td.UserToken) }
+
+// testSessions accepts exactly one user and token
+type testSessions struct {
+	id    int
+	token string
+}
+
+func (ts *testSessions) Create(int, time.Duration) *http.Cookie { return nil }
+
+func (ts *testSessions) Match(id int, token *conceal.Text) error {
+	if id != ts.id || token.Unveil() != ts.token {
+		return errors.New("no match")
+	}
+	return nil
+}
+
+func sessionCookie(id int, token string) *http.Cookie {
+	b, _ := json.Marshal(&testData{UserID: id, UserToken: token})
+	return &http.Cookie{Name: "session", Value: base64.StdEncoding.EncodeToString(b)}
+}
+
+func csrfHandler() (http.Handler, *string) {
+	rendered := new(string)
+	csrf := &CSRF[int]{
+		Key: conceal.NewBytes([]byte("0123456789abcdef0123456789abcdef")),
+		Next: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			*rendered = CSRFToken(r)
+			w.WriteHeader(http.StatusNoContent)
+		}),
+	}
+	return &SetSession[*testData, int]{
+		SessionCookieName: "session",
+		Sessions:          &testSessions{id: 42, token: "tok-1"},
+		Next:              csrf,
+	}, rendered
+}
+
+func serve(h http.Handler, r *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func TestCSRF_session(t *testing.T) {
+	t.Parallel()
+
+	h, rendered := csrfHandler()
+
+	// render a page with a token
+	get := httptest.NewRequest(http.MethodGet, "/", nil)
+	get.AddCookie(sessionCookie(42, "tok-1"))
+	must.Eq(t, http.StatusNoContent, serve(h, get).Code)
+	token := *rendered
+	must.NotEq(t, "", token)
+
+	t.Run("header", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodPost, "/", nil)
+		r.AddCookie(sessionCookie(42, "tok-1"))
+		r.Header.Set(DefaultCSRFHeaderName, token)
+		must.Eq(t, http.StatusNoContent, serve(h, r).Code)
+	})
+
+	t.Run("form", func(t *testing.T) {
+		form := url.Values{DefaultCSRFFieldName: {token}}
+		r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.AddCookie(sessionCookie(42, "tok-1"))
+		must.Eq(t, http.StatusNoContent, serve(h, r).Code)
+	})
+
+	t.Run("missing", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodPost, "/", nil)
+		r.AddCookie(sessionCookie(42, "tok-1"))
+		must.Eq(t, http.StatusForbidden, serve(h, r).Code)
+	})
+
+	t.Run("tampered", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodPost, "/", nil)
+		r.AddCookie(sessionCookie(42, "tok-1"))
+		last := "A"
+		if strings.HasSuffix(token, last) {
+			last = "B"
+		}
+		r.Header.Set(DefaultCSRFHeaderName, token[:len(token)-1]+last)
+		must.Eq(t, http.StatusForbidden, serve(h, r).Code)
+	})
+
+	t.Run("other session", func(t *testing.T) {
+		// a token minted for an anonymous session is not valid for the user
+		r := httptest.NewRequest(http.MethodPost, "/", nil)
+		r.AddCookie(&http.Cookie{Name: DefaultCSRFCookieName, Value: "abc"})
+		r.Header.Set(DefaultCSRFHeaderName, token)
+		must.Eq(t, http.StatusForbidden, serve(h, r).Code)
+	})
+}
+
+func TestCSRF_anonymous(t *testing.T) {
+	t.Parallel()
+
+	h, rendered := csrfHandler()
+
+	// first visit sets the double-submit cookie
+	w := serve(h, httptest.NewRequest(http.MethodGet, "/", nil))
+	must.Eq(t, http.StatusNoContent, w.Code)
+	cookies := w.Result().Cookies()
+	must.SliceLen(t, 1, cookies)
+	must.Eq(t, DefaultCSRFCookieName, cookies[0].Name)
+	must.True(t, cookies[0].HttpOnly)
+	token := *rendered
+
+	t.Run("with cookie", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodPost, "/", nil)
+		r.AddCookie(cookies[0])
+		r.Header.Set(DefaultCSRFHeaderName, token)
+		must.Eq(t, http.StatusNoContent, serve(h, r).Code)
+	})
+
+	t.Run("without cookie", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodPost, "/", nil)
+		r.Header.Set(DefaultCSRFHeaderName, token)
+		must.Eq(t, http.StatusForbidden, serve(h, r).Code)
+	})
+
+	t.Run("different cookie", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodPost, "/", nil)
+		r.AddCookie(&http.Cookie{Name: DefaultCSRFCookieName, Value: "attacker"})
+		r.Header.Set(DefaultCSRFHeaderName, token)
+		must.Eq(t, http.StatusForbidden, serve(h, r).Code)
+	})
+}
+
+func TestCSRFField(t *testing.T) {
+	t.Parallel()
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	must.Eq(t, "", CSRFField(r))
+
+	state := &csrfState{key: conceal.NewBytes([]byte("key")), binding: "b", field: "f"}
+	r = r.WithContext(context.WithValue(r.Context(), csrfContextKey, state))
+	field := string(CSRFField(r))
+	must.StrHasPrefix(t, `<input type="hidden" name="f" value="`, field)
+}
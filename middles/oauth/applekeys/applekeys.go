@@ -1,6 +1,7 @@
 package applekeys
 
 import (
+	"context"
 	"crypto/rsa"
 	"encoding/base64"
 	"encoding/json"
@@ -13,6 +14,8 @@ import (
 
 	"cattlecloud.net/go/scope"
 	"cattlecloud.net/go/webtools/middles/oauth"
+	"cattlecloud.net/go/webtools/middles/oauth/jwks"
+	"cattlecloud.net/go/webtools/middles/oauth/keyfetch"
 	"github.com/golang-jwt/jwt/v5"
 )
 
@@ -22,17 +25,26 @@ const public = "https://appleid.apple.com/auth/keys"
 type Claims struct {
 	// JWT standard types (scope: oidc)
 	jwt.RegisteredClaims
+	Nonce string `json:"nonce"`
 
 	// Apple Custom Types (scope: email)
 	Email         string `json:"email"`
 	EmailVerified bool   `json:"email_verified"`
 }
 
+// GetNonce returns the nonce claim, which must match the nonce sent with the
+// authorization request.
+func (c *Claims) GetNonce() string {
+	return c.Nonce
+}
+
 type Options struct {
 	endpoint   string
 	cache      oauth.Cache[string, *rsa.PublicKey]
 	httpClient *http.Client
 	clientID   string
+	keySet     *jwks.KeySet
+	fetcher    *keyfetch.Fetcher
 }
 
 type OptionFunc func(*Options)
@@ -49,6 +61,23 @@ func SetEndpoint(s string) OptionFunc {
 	return func(o *Options) { o.endpoint = s }
 }
 
+func SetCache(c oauth.Cache[string, *rsa.PublicKey]) OptionFunc {
+	return func(o *Options) { o.cache = c }
+}
+
+// SetKeySet sets a shared jwks.KeySet from which public keys are looked up,
+// instead of the endpoint of the validator.
+func SetKeySet(ks *jwks.KeySet) OptionFunc {
+	return func(o *Options) { o.keySet = ks }
+}
+
+// SetFetcher sets the keyfetch.Fetcher of the public keys, e.g. to change the
+// bounds of how long keys are cached. By default the keys of the endpoint are
+// fetched using the http client of the validator.
+func SetFetcher(f *keyfetch.Fetcher) OptionFunc {
+	return func(o *Options) { o.fetcher = f }
+}
+
 func New(opts ...OptionFunc) Validator {
 	options := &Options{
 		endpoint:   public,
@@ -60,11 +89,15 @@ func New(opts ...OptionFunc) Validator {
 		opt(options)
 	}
 
+	if options.fetcher == nil {
+		options.fetcher = keyfetch.New(options.endpoint, keyfetch.SetHTTP(options.httpClient))
+	}
+
 	return &validator{
-		vc:  options.cache,
-		hc:  options.httpClient,
-		id:  options.clientID,
-		url: options.endpoint,
+		vc: oauth.NewLoadingCache(options.cache),
+		kf: options.fetcher,
+		id: options.clientID,
+		ks: options.keySet,
 	}
 }
 
@@ -73,10 +106,10 @@ type Validator interface {
 }
 
 type validator struct {
-	vc  oauth.Cache[string, *rsa.PublicKey]
-	hc  *http.Client
-	id  string
-	url string
+	vc *oauth.LoadingCache[*rsa.PublicKey]
+	kf *keyfetch.Fetcher
+	id string
+	ks *jwks.KeySet
 }
 
 func (v *validator) Validate(token string) (*Claims, error) {
@@ -88,8 +121,12 @@ func (v *validator) Validate(token string) (*Claims, error) {
 		claims,
 		func(t *jwt.Token) (any, error) {
 			keyID := fmt.Sprintf("%s", t.Header["kid"])
+			if v.ks != nil {
+				return v.getKey(keyID)
+			}
 			return v.getAppleCert(keyID)
 		},
+		jwt.WithValidMethods([]string{"RS256"}),
 	)
 
 	// unable to get token or parse it
@@ -120,27 +157,26 @@ func (v *validator) Validate(token string) (*Claims, error) {
 	return claims, nil
 }
 
-func (v *validator) getAppleCert(keyID string) (*rsa.PublicKey, error) {
-	public, exists := v.vc.Get(keyID)
-
-	switch {
-	case exists:
-		return public, nil
-	default:
-		// no such certificate in the cache;
-		// continue with http request to apple for a certificate
-	}
+func (v *validator) getKey(keyID string) (any, error) {
+	ctx, cancel := scope.TTL(30 * time.Second)
+	defer cancel()
+
+	return v.ks.Key(ctx, keyID)
+}
 
+func (v *validator) getAppleCert(keyID string) (*rsa.PublicKey, error) {
 	ctx, cancel := scope.TTL(30 * time.Second)
 	defer cancel()
 
-	request, _ := http.NewRequestWithContext(ctx, http.MethodGet, v.url, nil)
-	response, derr := v.hc.Do(request)
-	if derr != nil {
-		return nil, derr
-	}
-	defer func() { _ = response.Body.Close() }()
+	// concurrent lookups of the same missing key result in one fetch
+	return v.vc.GetOrLoad(ctx, keyID, func(ctx context.Context) (*rsa.PublicKey, time.Duration, error) {
+		return keyfetch.Load(ctx, v.kf, keyID, v.parseAppleCerts)
+	})
+}
 
+// parseAppleCerts finds the key of keyID among the Apple keys of body, putting
+// the other keys into the cache
+func (v *validator) parseAppleCerts(ctx context.Context, body []byte, keyID string, ttl time.Duration) (*rsa.PublicKey, bool, error) {
 	var data struct {
 		Keys []struct {
 			Kid string `json:"kid"`
@@ -149,30 +185,36 @@ func (v *validator) getAppleCert(keyID string) (*rsa.PublicKey, error) {
 		} `json:"keys"`
 	}
 
-	if err := json.NewDecoder(response.Body).Decode(&data); err != nil {
-		return nil, err
+	if err := json.Unmarshal(body, &data); err != nil {
+		return nil, false, err
 	}
 
+	keys := make(map[string]*rsa.PublicKey, len(data.Keys))
 	for _, key := range data.Keys {
-		if key.Kid == keyID {
-			nBytes, err1 := base64.RawURLEncoding.DecodeString(key.N)
-			if err1 != nil {
-				return nil, err1
-			}
-			eBytes, err2 := base64.RawURLEncoding.DecodeString(key.E)
-			if err2 != nil {
-				return nil, err2
-			}
-			n := new(big.Int).SetBytes(nBytes)
-			e := int(new(big.Int).SetBytes(eBytes).Int64())
-			public := &rsa.PublicKey{N: n, E: e}
-
-			// set the key we got into the cache
-			v.vc.Put(keyID, public, 1*time.Hour)
-
-			return public, nil
+		public, perr := parseKey(key.N, key.E)
+		switch {
+		case perr == nil:
+			keys[key.Kid] = public
+		case key.Kid == keyID:
+			return nil, false, perr
 		}
 	}
 
-	return nil, errors.New("oauth/applekeys: Apple public key not found")
+	key, found := keyfetch.Pick(ctx, v.vc, keys, keyID, ttl)
+	return key, found, nil
+}
+
+// parseKey returns the RSA public key of base64url encoded modulus and exponent
+func parseKey(n64, e64 string) (*rsa.PublicKey, error) {
+	nBytes, err := base64.RawURLEncoding.DecodeString(n64)
+	if err != nil {
+		return nil, err
+	}
+	eBytes, err := base64.RawURLEncoding.DecodeString(e64)
+	if err != nil {
+		return nil, err
+	}
+	n := new(big.Int).SetBytes(nBytes)
+	e := int(new(big.Int).SetBytes(eBytes).Int64())
+	return &rsa.PublicKey{N: n, E: e}, nil
 }
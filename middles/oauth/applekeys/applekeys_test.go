@@ -11,6 +11,8 @@ import (
 	"testing"
 	"time"
 
+	"cattlecloud.net/go/webtools/middles/oauth/internal/keytest"
+	"cattlecloud.net/go/webtools/middles/oauth/jwks"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/shoenig/test/must"
 )
@@ -85,3 +87,29 @@ func TestValidator_Validate(t *testing.T) {
 	must.True(t, validatedClaims.EmailVerified)
 	must.Eq(t, "apple-user-123", validatedClaims.Subject)
 }
+
+func TestValidator_Validate_keySet(t *testing.T) {
+	t.Parallel()
+
+	const clientID = "test-shared-client"
+
+	now := time.Now()
+	claims := &Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    "https://appleid.apple.com",
+			Audience:  jwt.ClaimStrings{clientID},
+			ExpiresAt: jwt.NewNumericDate(now.Add(1 * time.Hour)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			Subject:   "shared-user-123",
+		},
+		EmailVerified: true,
+	}
+
+	keytest.RS256Only(t, func(ks *jwks.KeySet) func(string) error {
+		v := New(SetClientID(clientID), SetKeySet(ks))
+		return func(token string) error {
+			_, err := v.Validate(token)
+			return err
+		}
+	}, claims)
+}
@@ -0,0 +1,114 @@
+package oauth
+
+import (
+	"context"
+	"errors"
+	"iter"
+	"time"
+)
+
+// ErrNotSupported indicates a Cache does not implement an optional capability.
+var ErrNotSupported = errors.New("cache: operation not supported")
+
+// Cache could be implemented using an in-memory cache, a memcached instance,
+// or even persistent storage.
+//
+// A Cache may optionally implement any of Deleter, Counter, Ranger, Taker,
+// Adder, and ContextCache, which are used when available.
+type Cache[K, T any] interface {
+	Get(K) (T, bool)
+	Put(K, T, time.Duration)
+}
+
+// Deleter is implemented by a Cache which can remove an item before the item
+// expires.
+type Deleter[K any] interface {
+	Delete(K)
+}
+
+// Counter is implemented by a Cache which can report the number of live items
+// being stored.
+type Counter interface {
+	Len() int
+}
+
+// Ranger is implemented by a Cache which can iterate over its live items.
+type Ranger[K, T any] interface {
+	All() iter.Seq2[K, T]
+}
+
+// Taker is implemented by a Cache which can atomically get and delete an item,
+// such that of many concurrent callers taking the same item, only one receives
+// the item.
+type Taker[K, T any] interface {
+	Take(context.Context, K) (T, bool, error)
+}
+
+// Adder is implemented by a Cache which can atomically put an item only if no
+// live item of the key exists, such that of many concurrent callers adding the
+// same key, only one succeeds.
+type Adder[K, T any] interface {
+	Add(context.Context, K, T, time.Duration) (bool, error)
+}
+
+// ContextCache is implemented by a Cache which is backed by a remote service,
+// where operations may be canceled, or fail.
+type ContextCache[K, T any] interface {
+	GetContext(context.Context, K) (T, bool, error)
+	PutContext(context.Context, K, T, time.Duration) error
+	DeleteContext(context.Context, K) error
+}
+
+// Get the value of key from c, using the ContextCache implementation of c if
+// available.
+func Get[K, T any](ctx context.Context, c Cache[K, T], key K) (T, bool, error) {
+	if cc, ok := c.(ContextCache[K, T]); ok {
+		return cc.GetContext(ctx, key)
+	}
+	value, exists := c.Get(key)
+	return value, exists, nil
+}
+
+// Put value of key into c, using the ContextCache implementation of c if
+// available.
+func Put[K, T any](ctx context.Context, c Cache[K, T], key K, value T, ttl time.Duration) error {
+	if cc, ok := c.(ContextCache[K, T]); ok {
+		return cc.PutContext(ctx, key, value, ttl)
+	}
+	c.Put(key, value, ttl)
+	return nil
+}
+
+// Delete key from c, using the ContextCache or Deleter implementation of c if
+// available. If c implements neither, ErrNotSupported is returned.
+func Delete[K, T any](ctx context.Context, c Cache[K, T], key K) error {
+	switch cc := c.(type) {
+	case ContextCache[K, T]:
+		return cc.DeleteContext(ctx, key)
+	case Deleter[K]:
+		cc.Delete(key)
+		return nil
+	default:
+		return ErrNotSupported
+	}
+}
+
+// Take atomically gets and deletes key from c. If c does not implement Taker,
+// ErrNotSupported is returned.
+func Take[K, T any](ctx context.Context, c Cache[K, T], key K) (T, bool, error) {
+	if t, ok := c.(Taker[K, T]); ok {
+		return t.Take(ctx, key)
+	}
+	var empty T
+	return empty, false, ErrNotSupported
+}
+
+// Add atomically puts value of key into c only if key does not exist, returning
+// whether value was put. If c does not implement Adder, ErrNotSupported is
+// returned.
+func Add[K, T any](ctx context.Context, c Cache[K, T], key K, value T, ttl time.Duration) (bool, error) {
+	if a, ok := c.(Adder[K, T]); ok {
+		return a.Add(ctx, key, value, ttl)
+	}
+	return false, ErrNotSupported
+}
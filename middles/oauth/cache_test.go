@@ -0,0 +1,91 @@
+package oauth
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/shoenig/go-conceal"
+	"github.com/shoenig/test/must"
+)
+
+var (
+	_ Deleter[string]              = (*VolatileCache[int])(nil)
+	_ Counter                      = (*VolatileCache[int])(nil)
+	_ Ranger[string, int]          = (*VolatileCache[int])(nil)
+	_ Taker[string, int]           = (*VolatileCache[int])(nil)
+	_ Taker[string, int]           = (*ShardedCache[int])(nil)
+	_ ContextCache[string, string] = (*failingCache)(nil)
+)
+
+var errBackend = errors.New("backend is down")
+
+// failingCache is a ContextCache where every operation fails
+type failingCache struct{}
+
+func (*failingCache) Get(string) (string, bool)         { return "", false }
+func (*failingCache) Put(string, string, time.Duration) {}
+
+func (*failingCache) GetContext(context.Context, string) (string, bool, error) {
+	return "", false, errBackend
+}
+
+func (*failingCache) PutContext(context.Context, string, string, time.Duration) error {
+	return errBackend
+}
+
+func (*failingCache) DeleteContext(context.Context, string) error {
+	return errBackend
+}
+
+func TestCache_helpers(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	t.Run("basic", func(t *testing.T) {
+		c := &mockCache{storage: make(map[string]rowid)}
+		key := conceal.New("key")
+
+		must.NoError(t, Put(ctx, c, key, 1, time.Minute))
+		value, exists, err := Get(ctx, c, key)
+		must.NoError(t, err)
+		must.True(t, exists)
+		must.Eq(t, 1, value)
+
+		// mockCache does not support deletion
+		must.ErrorIs(t, Delete(ctx, c, key), ErrNotSupported)
+		_, _, terr := Take(ctx, c, key)
+		must.ErrorIs(t, terr, ErrNotSupported)
+	})
+
+	t.Run("deleter", func(t *testing.T) {
+		c := NewVolatileCache[int](size)
+		must.NoError(t, Put(ctx, c, "key", 1, time.Minute))
+		must.NoError(t, Delete(ctx, c, "key"))
+		_, exists, err := Get(ctx, c, "key")
+		must.NoError(t, err)
+		must.False(t, exists)
+	})
+
+	t.Run("taker", func(t *testing.T) {
+		c := NewVolatileCache[int](size)
+		must.NoError(t, Put(ctx, c, "key", 1, time.Minute))
+		value, exists, err := Take(ctx, c, "key")
+		must.NoError(t, err)
+		must.True(t, exists)
+		must.Eq(t, 1, value)
+		_, exists, err = Take(ctx, c, "key")
+		must.NoError(t, err)
+		must.False(t, exists)
+	})
+
+	t.Run("context", func(t *testing.T) {
+		c := new(failingCache)
+		must.ErrorIs(t, Put(ctx, c, "key", "value", time.Minute), errBackend)
+		_, _, err := Get(ctx, c, "key")
+		must.ErrorIs(t, err, errBackend)
+		must.ErrorIs(t, Delete(ctx, c, "key"), errBackend)
+	})
+}
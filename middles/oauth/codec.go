@@ -0,0 +1,25 @@
+package oauth
+
+import (
+	"encoding/json"
+)
+
+// Codec is used to encode and decode values of type T, for caches which store
+// values outside of process memory.
+type Codec[T any] interface {
+	Encode(T) ([]byte, error)
+	Decode([]byte) (T, error)
+}
+
+// JSONCodec is a Codec which makes use of encoding/json.
+type JSONCodec[T any] struct{}
+
+func (JSONCodec[T]) Encode(value T) ([]byte, error) {
+	return json.Marshal(value)
+}
+
+func (JSONCodec[T]) Decode(b []byte) (T, error) {
+	var value T
+	err := json.Unmarshal(b, &value)
+	return value, err
+}
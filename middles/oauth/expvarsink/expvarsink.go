@@ -0,0 +1,49 @@
+// Package expvarsink provides an implementation of oauth.MetricsSink which
+// publishes measurements using expvar.
+//
+// Importing this package imports expvar, which registers the /debug/vars
+// handler on http.DefaultServeMux.
+package expvarsink
+
+import (
+	"expvar"
+	"sync"
+	"time"
+
+	"cattlecloud.net/go/webtools/middles/oauth"
+)
+
+// New creates a Sink which publishes measurements as an expvar.Map of the
+// given name, e.g. for serving on /debug/vars.
+//
+// Counts are published as "<cache>.<event>", and latencies are published as
+// the cumulative "<cache>.<operation>_ns" and "<cache>.<operation>_calls".
+//
+// Creating more than one Sink of the same name returns sinks sharing the same
+// expvar.Map.
+func New(name string) *Sink {
+	lock.Lock()
+	defer lock.Unlock()
+
+	m, ok := expvar.Get(name).(*expvar.Map)
+	if !ok {
+		m = expvar.NewMap(name)
+	}
+	return &Sink{m: m}
+}
+
+var lock sync.Mutex
+
+// Sink is an oauth.MetricsSink which publishes measurements using expvar.
+type Sink struct {
+	m *expvar.Map
+}
+
+func (s *Sink) Count(name string, event oauth.Event) {
+	s.m.Add(name+"."+event.String(), 1)
+}
+
+func (s *Sink) Latency(name string, operation string, elapsed time.Duration) {
+	s.m.Add(name+"."+operation+"_ns", elapsed.Nanoseconds())
+	s.m.Add(name+"."+operation+"_calls", 1)
+}
@@ -0,0 +1,45 @@
+package expvarsink
+
+import (
+	"expvar"
+	"testing"
+	"time"
+
+	"cattlecloud.net/go/webtools/middles/oauth"
+	"github.com/shoenig/go-conceal"
+	"github.com/shoenig/test/must"
+)
+
+var _ oauth.MetricsSink = (*Sink)(nil)
+
+func TestSink(t *testing.T) {
+	t.Parallel()
+
+	sink := New("test_expvar_sink")
+	sink.Count("cache", oauth.EventHit)
+	sink.Count("cache", oauth.EventHit)
+	sink.Latency("cache", "get", 3*time.Millisecond)
+
+	// sinks of the same name share the same map
+	sink2 := New("test_expvar_sink")
+	sink2.Count("cache", oauth.EventHit)
+
+	m := expvar.Get("test_expvar_sink").(*expvar.Map)
+	must.Eq(t, "3", m.Get("cache.hit").String())
+	must.Eq(t, "3000000", m.Get("cache.get_ns").String())
+	must.Eq(t, "1", m.Get("cache.get_calls").String())
+}
+
+func TestSink_Sessions(t *testing.T) {
+	t.Parallel()
+
+	cache := oauth.TextKeys(oauth.NewVolatileCache[int](10))
+	sessions := oauth.NewSessions(
+		&oauth.CookieFactory[int]{},
+		oauth.Instrument("sessions", cache, New("test_expvar_sessions")),
+	)
+	_ = sessions.Match(1, conceal.UUIDv4())
+
+	m := expvar.Get("test_expvar_sessions").(*expvar.Map)
+	must.Eq(t, "1", m.Get("sessions.miss").String())
+}
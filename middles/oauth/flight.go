@@ -0,0 +1,67 @@
+package oauth
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// flightTimeout bounds each call of a flight, which is not bounded by the
+// context of any one caller
+const flightTimeout = 1 * time.Minute
+
+// flight deduplicates concurrent calls for the same key, such that only one
+// call is in flight at a time and its result is shared with every caller
+type flight[T any] struct {
+	lock  sync.Mutex
+	calls map[string]*call[T]
+}
+
+type call[T any] struct {
+	done   chan struct{}
+	value  T
+	exists bool
+	err    error
+}
+
+// do calls fn for key, unless a call for key is already in flight, in which
+// case the result of that call is returned instead.
+//
+// The call is detached from the cancellation of ctx, such that one caller
+// going away does not fail the others; waiting for the result is bounded by
+// the ctx of each caller.
+func (f *flight[T]) do(ctx context.Context, key string, fn func(context.Context) (T, bool, error)) (T, bool, error) {
+	f.lock.Lock()
+	if f.calls == nil {
+		f.calls = make(map[string]*call[T])
+	}
+	c, exists := f.calls[key]
+	if !exists {
+		c = &call[T]{done: make(chan struct{})}
+		f.calls[key] = c
+		go f.run(context.WithoutCancel(ctx), key, c, fn)
+	}
+	f.lock.Unlock()
+
+	select {
+	case <-c.done:
+		return c.value, c.exists, c.err
+	case <-ctx.Done():
+		var empty T
+		return empty, false, ctx.Err()
+	}
+}
+
+func (f *flight[T]) run(ctx context.Context, key string, c *call[T], fn func(context.Context) (T, bool, error)) {
+	ctx, cancel := context.WithTimeout(ctx, flightTimeout)
+	defer cancel()
+
+	defer func() {
+		f.lock.Lock()
+		delete(f.calls, key)
+		f.lock.Unlock()
+		close(c.done)
+	}()
+
+	c.value, c.exists, c.err = fn(ctx)
+}
@@ -1,6 +1,8 @@
 package googlekeys
 
 import (
+	"context"
+	"crypto/rsa"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -10,6 +12,8 @@ import (
 
 	"cattlecloud.net/go/scope"
 	"cattlecloud.net/go/webtools/middles/oauth"
+	"cattlecloud.net/go/webtools/middles/oauth/jwks"
+	"cattlecloud.net/go/webtools/middles/oauth/keyfetch"
 	"github.com/golang-jwt/jwt/v5"
 )
 
@@ -19,17 +23,26 @@ const public = "https://www.googleapis.com/oauth2/v1/certs"
 type Claims struct {
 	// JWT standard types (scope: oidc)
 	jwt.RegisteredClaims
+	Nonce string `json:"nonce"`
 
 	// Google custom types (scope: email)
 	Email         string `json:"email"`
 	EmailVerified bool   `json:"email_verified"`
 }
 
+// GetNonce returns the nonce claim, which must match the nonce sent with the
+// authorization request.
+func (c *Claims) GetNonce() string {
+	return c.Nonce
+}
+
 type Options struct {
 	endpoint   string
-	cache      oauth.Cache[string, string]
+	cache      oauth.Cache[string, *rsa.PublicKey]
 	httpClient *http.Client
 	clientID   string
+	keySet     *jwks.KeySet
+	fetcher    *keyfetch.Fetcher
 }
 
 type OptionFunc func(*Options)
@@ -46,10 +59,27 @@ func SetEndpoint(s string) OptionFunc {
 	return func(o *Options) { o.endpoint = s }
 }
 
+func SetCache(c oauth.Cache[string, *rsa.PublicKey]) OptionFunc {
+	return func(o *Options) { o.cache = c }
+}
+
+// SetKeySet sets a shared jwks.KeySet from which public keys are looked up,
+// instead of the endpoint of the validator.
+func SetKeySet(ks *jwks.KeySet) OptionFunc {
+	return func(o *Options) { o.keySet = ks }
+}
+
+// SetFetcher sets the keyfetch.Fetcher of the public keys, e.g. to change the
+// bounds of how long keys are cached. By default the keys of the endpoint are
+// fetched using the http client of the validator.
+func SetFetcher(f *keyfetch.Fetcher) OptionFunc {
+	return func(o *Options) { o.fetcher = f }
+}
+
 func New(opts ...OptionFunc) Validator {
 	options := &Options{
 		endpoint:   public,
-		cache:      oauth.NewVolatileCache[string](8),
+		cache:      oauth.NewVolatileCache[*rsa.PublicKey](8),
 		httpClient: &http.Client{Timeout: 1 * time.Minute},
 	}
 
@@ -57,11 +87,15 @@ func New(opts ...OptionFunc) Validator {
 		opt(options)
 	}
 
+	if options.fetcher == nil {
+		options.fetcher = keyfetch.New(options.endpoint, keyfetch.SetHTTP(options.httpClient))
+	}
+
 	return &validator{
-		vc:  options.cache,
-		hc:  options.httpClient,
-		id:  options.clientID,
-		url: options.endpoint,
+		vc: oauth.NewLoadingCache(options.cache),
+		kf: options.fetcher,
+		id: options.clientID,
+		ks: options.keySet,
 	}
 }
 
@@ -70,10 +104,10 @@ type Validator interface {
 }
 
 type validator struct {
-	vc  oauth.Cache[string, string]
-	hc  *http.Client
-	id  string
-	url string
+	vc *oauth.LoadingCache[*rsa.PublicKey]
+	kf *keyfetch.Fetcher
+	id string
+	ks *jwks.KeySet
 }
 
 func (g *validator) Validate(token string) (*Claims, error) {
@@ -87,12 +121,12 @@ func (g *validator) Validate(token string) (*Claims, error) {
 		claims,
 		func(t *jwt.Token) (any, error) {
 			keyID := fmt.Sprintf("%s", t.Header["kid"])
-			pem, err := g.getGoogleCert(keyID)
-			if err != nil {
-				return nil, err
+			if g.ks != nil {
+				return g.getKey(keyID)
 			}
-			return jwt.ParseRSAPublicKeyFromPEM([]byte(pem))
+			return g.getGoogleCert(keyID)
 		},
+		jwt.WithValidMethods([]string{"RS256"}),
 	)
 
 	// unable to get token or parse it
@@ -124,57 +158,43 @@ func (g *validator) Validate(token string) (*Claims, error) {
 	return claims2, nil
 }
 
-func (g *validator) getGoogleCert(keyID string) (string, error) {
-	public, exists := g.vc.Get(keyID)
+func (g *validator) getKey(keyID string) (any, error) {
+	ctx, cancel := scope.TTL(30 * time.Second)
+	defer cancel()
 
-	switch {
-	case exists:
-		return public, nil
-	default:
-		// no such certificate in the cache;
-		// continue with http request to google for a certificate
-	}
+	return g.ks.Key(ctx, keyID)
+}
 
+func (g *validator) getGoogleCert(keyID string) (*rsa.PublicKey, error) {
 	ctx, cancel := scope.TTL(30 * time.Second)
 	defer cancel()
 
-	request, _ := http.NewRequestWithContext(ctx, http.MethodGet, g.url, nil)
-	response, derr := g.hc.Do(request)
-	if derr != nil {
-		return "", derr
-	}
-	defer func() { _ = response.Body.Close() }()
-
-	// extract the certificates Expires header to get cache TTL
-	ttl := g.certsTTL(time.Now(), response)
+	// concurrent lookups of the same missing key result in one fetch
+	return g.vc.GetOrLoad(ctx, keyID, func(ctx context.Context) (*rsa.PublicKey, time.Duration, error) {
+		return keyfetch.Load(ctx, g.kf, keyID, g.parseGoogleCerts)
+	})
+}
 
+// parseGoogleCerts finds the key of keyID among the Google certificates of
+// body, putting the other keys into the cache
+func (g *validator) parseGoogleCerts(ctx context.Context, body []byte, keyID string, ttl time.Duration) (*rsa.PublicKey, bool, error) {
 	// extract the content of the response
 	data := make(map[string]string)
-	if err := json.NewDecoder(response.Body).Decode(&data); err != nil {
-		return "", err
-	}
-
-	// iterate each returned key and put it into the cache
-	for k, v := range data {
-		g.vc.Put(k, v, ttl)
+	if err := json.Unmarshal(body, &data); err != nil {
+		return nil, false, err
 	}
 
-	// lookup the key we actually wanted
-	key, exists := data[keyID]
-	if !exists {
-		return "", errors.New("oauth/googlekeys: Google public key not found")
-	}
-
-	return key, nil
-}
-
-func (g *validator) certsTTL(now time.Time, r *http.Response) time.Duration {
-	header := r.Header.Get("Expires")
-
-	expiration, err := time.Parse("Mon, 02 Jan 2006 15:04:05 MST", header)
-	if err != nil {
-		return 1 * time.Hour
+	keys := make(map[string]*rsa.PublicKey, len(data))
+	for kid, pem := range data {
+		public, perr := jwt.ParseRSAPublicKeyFromPEM([]byte(pem))
+		switch {
+		case perr == nil:
+			keys[kid] = public
+		case kid == keyID:
+			return nil, false, fmt.Errorf("oauth/googlekeys: unable to parse Google public key: %w", perr)
+		}
 	}
 
-	return expiration.Sub(now)
+	key, found := keyfetch.Pick(ctx, g.vc, keys, keyID, ttl)
+	return key, found, nil
 }
@@ -8,9 +8,15 @@ import (
 	"encoding/pem"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"cattlecloud.net/go/webtools/middles/oauth/internal/keytest"
+	"cattlecloud.net/go/webtools/middles/oauth/jwks"
+	"cattlecloud.net/go/webtools/middles/oauth/keyfetch"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/shoenig/test/must"
 )
@@ -79,40 +85,177 @@ func TestValidator_Validate(t *testing.T) {
 	must.True(t, validation.EmailVerified)
 }
 
-func TestValidator_certsTTL(t *testing.T) {
+func TestValidator_Validate_coalesce(t *testing.T) {
 	t.Parallel()
 
-	t.Run("actual", func(t *testing.T) {
-		v := new(validator)
+	const kid = "test-key-id"
+	const clientID = "test-case-client"
 
-		response := &http.Response{
-			Header: map[string][]string{
-				"Expires": {"Fri, 01 Nov 2024 00:34:53 GMT"},
-			},
-		}
+	privateKey, perr := rsa.GenerateKey(rand.Reader, 2048)
+	must.NoError(t, perr)
+	publicKey, berr := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+	must.NoError(t, berr)
+	publicKeyPem := pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PUBLIC KEY",
+		Bytes: publicKey,
+	})
 
-		now := time.Date(2024, 10, 31, 13, 50, 10, 0, time.UTC)
+	// count the requests, holding them until every login is waiting
+	var requests atomic.Int64
+	release := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		requests.Add(1)
+		<-release
+		_ = json.NewEncoder(w).Encode(map[string]string{kid: string(publicKeyPem)})
+	}))
+	t.Cleanup(ts.Close)
 
-		ttl := v.certsTTL(now, response)
+	v := New(
+		SetHTTP(ts.Client()),
+		SetClientID(clientID),
+		SetEndpoint(ts.URL),
+	)
 
-		exp := 10*time.Hour + 44*time.Minute + 43*time.Second
-		must.Eq(t, exp, ttl)
+	now := time.Now()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, &Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    "https://accounts.google.com",
+			Audience:  jwt.ClaimStrings{clientID},
+			ExpiresAt: jwt.NewNumericDate(now.Add(1 * time.Hour)),
+		},
+		EmailVerified: true,
 	})
+	token.Header["kid"] = kid
+	signedToken, err := token.SignedString(privateKey)
+	must.NoError(t, err)
+
+	var wg sync.WaitGroup
+	for range 20 {
+		wg.Go(func() {
+			_, verr := v.Validate(signedToken)
+			must.NoError(t, verr)
+		})
+	}
+
+	for requests.Load() == 0 {
+		time.Sleep(1 * time.Millisecond)
+	}
+	time.Sleep(10 * time.Millisecond) // let the other logins pile up
+	close(release)
+	wg.Wait()
+
+	must.Eq(t, 1, requests.Load())
+}
+
+func TestValidator_Validate_unknownKey(t *testing.T) {
+	t.Parallel()
+
+	const clientID = "test-case-client"
 
-	t.Run("parse-failure", func(t *testing.T) {
-		v := new(validator)
+	privateKey, perr := rsa.GenerateKey(rand.Reader, 2048)
+	must.NoError(t, perr)
+	publicKey, berr := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+	must.NoError(t, berr)
+	publicKeyPem := pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PUBLIC KEY",
+		Bytes: publicKey,
+	})
 
-		response := &http.Response{
-			Header: map[string][]string{
-				"Expires": {"Bob, 01 Nov 2024 00:34:53 GMT"},
+	var requests atomic.Int64
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		requests.Add(1)
+		_ = json.NewEncoder(w).Encode(map[string]string{"test-key-id": string(publicKeyPem)})
+	}))
+	t.Cleanup(ts.Close)
+
+	v := New(
+		SetHTTP(ts.Client()),
+		SetClientID(clientID),
+		SetEndpoint(ts.URL),
+	)
+
+	// tokens of made up key ids do not each cause a fetch
+	for i := range 10 {
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, &Claims{
+			RegisteredClaims: jwt.RegisteredClaims{
+				Issuer:    "https://accounts.google.com",
+				Audience:  jwt.ClaimStrings{clientID},
+				ExpiresAt: jwt.NewNumericDate(time.Now().Add(1 * time.Hour)),
 			},
+			EmailVerified: true,
+		})
+		token.Header["kid"] = "made-up-" + strconv.Itoa(i)
+		signedToken, err := token.SignedString(privateKey)
+		must.NoError(t, err)
+
+		_, verr := v.Validate(signedToken)
+		must.ErrorIs(t, verr, keyfetch.ErrKeyNotFound)
+	}
+
+	must.Eq(t, 1, requests.Load())
+}
+
+func TestValidator_Validate_keySet(t *testing.T) {
+	t.Parallel()
+
+	const clientID = "test-shared-client"
+
+	now := time.Now()
+	claims := &Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    "https://accounts.google.com",
+			Audience:  jwt.ClaimStrings{clientID},
+			ExpiresAt: jwt.NewNumericDate(now.Add(1 * time.Hour)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			Subject:   "shared-user-123",
+		},
+		EmailVerified: true,
+	}
+
+	keytest.RS256Only(t, func(ks *jwks.KeySet) func(string) error {
+		v := New(SetClientID(clientID), SetKeySet(ks))
+		return func(token string) error {
+			_, err := v.Validate(token)
+			return err
 		}
+	}, claims)
+}
+
+func BenchmarkValidator_Validate(b *testing.B) {
+	const kid = "test-key-id"
+	const clientID = "test-case-client"
+
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	must.NoError(b, err)
 
-		now := time.Date(2024, 10, 31, 13, 50, 10, 0, time.UTC)
+	publicKey, err := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+	must.NoError(b, err)
+	publicKeyPem := pem.EncodeToMemory(&pem.Block{Type: "RSA PUBLIC KEY", Bytes: publicKey})
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]string{kid: string(publicKeyPem)})
+	}))
+	b.Cleanup(ts.Close)
 
-		ttl := v.certsTTL(now, response)
+	v := New(SetHTTP(ts.Client()), SetClientID(clientID), SetEndpoint(ts.URL))
 
-		exp := 1 * time.Hour // the fallback cache expiration
-		must.Eq(t, exp, ttl)
+	now := time.Now()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, &Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    "https://accounts.google.com",
+			Audience:  jwt.ClaimStrings{clientID},
+			ExpiresAt: jwt.NewNumericDate(now.Add(1 * time.Hour)),
+		},
+		EmailVerified: true,
 	})
+	token.Header["kid"] = kid
+	signedToken, err := token.SignedString(privateKey)
+	must.NoError(b, err)
+
+	b.ReportAllocs()
+	for b.Loop() {
+		if _, verr := v.Validate(signedToken); verr != nil {
+			b.Fatal(verr)
+		}
+	}
 }
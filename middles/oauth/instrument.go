@@ -0,0 +1,179 @@
+package oauth
+
+import (
+	"context"
+	"time"
+)
+
+// Event is something which happened to an item in a Cache.
+type Event int
+
+const (
+	EventHit    Event = iota // item found by a lookup
+	EventMiss                // item not found by a lookup
+	EventExpire              // item purged because it expired
+	EventEvict               // item purged to make room for another item
+	EventPut                 // item stored
+	EventError               // cache operation failed
+	EventDelete              // item deleted
+)
+
+func (e Event) String() string {
+	switch e {
+	case EventHit:
+		return "hit"
+	case EventMiss:
+		return "miss"
+	case EventExpire:
+		return "expire"
+	case EventEvict:
+		return "evict"
+	case EventPut:
+		return "put"
+	case EventError:
+		return "error"
+	case EventDelete:
+		return "delete"
+	default:
+		return "unknown"
+	}
+}
+
+// Observable is implemented by a Cache which can report items being purged
+// because they expired or were evicted, e.g. VolatileCache. Each call to
+// Observe adds an observer, so that more than one Instrumented may wrap the
+// same Cache.
+type Observable interface {
+	Observe(func(Event))
+}
+
+// MetricsSink receives the measurements of an Instrumented cache, e.g. for
+// exporting to a metrics system. See package expvarsink for an implementation
+// using expvar.
+type MetricsSink interface {
+	// Count one occurrence of event in the named cache.
+	Count(name string, event Event)
+
+	// Latency records the duration of an operation (get, put, take, or
+	// delete) on the named cache.
+	Latency(name string, operation string, elapsed time.Duration)
+}
+
+// Instrument wraps cache such that each operation is measured and reported to
+// sink under the given name. If cache is Observable, expirations and evictions
+// are also reported.
+func Instrument[K, T any](name string, cache Cache[K, T], sink MetricsSink) *Instrumented[K, T] {
+	if o, ok := cache.(Observable); ok {
+		o.Observe(func(e Event) { sink.Count(name, e) })
+	}
+	return &Instrumented[K, T]{
+		name:  name,
+		cache: cache,
+		sink:  sink,
+		clock: time.Now,
+	}
+}
+
+// Instrumented is a Cache which reports measurements of each operation on an
+// underlying Cache to a MetricsSink.
+//
+// Instrumented implements ContextCache and Taker, making use of the optional
+// capabilities of the underlying Cache when available.
+type Instrumented[K, T any] struct {
+	name  string
+	cache Cache[K, T]
+	sink  MetricsSink
+	clock func() time.Time
+}
+
+func (i *Instrumented[K, T]) Get(key K) (T, bool) {
+	value, exists, _ := i.GetContext(context.Background(), key)
+	return value, exists
+}
+
+func (i *Instrumented[K, T]) Put(key K, value T, ttl time.Duration) {
+	_ = i.PutContext(context.Background(), key, value, ttl)
+}
+
+func (i *Instrumented[K, T]) GetContext(ctx context.Context, key K) (T, bool, error) {
+	start := i.clock()
+	value, exists, err := Get(ctx, i.cache, key)
+	i.sink.Latency(i.name, "get", i.clock().Sub(start))
+
+	switch {
+	case err != nil:
+		i.sink.Count(i.name, EventError)
+	case exists:
+		i.sink.Count(i.name, EventHit)
+	default:
+		i.sink.Count(i.name, EventMiss)
+	}
+
+	return value, exists, err
+}
+
+func (i *Instrumented[K, T]) PutContext(ctx context.Context, key K, value T, ttl time.Duration) error {
+	start := i.clock()
+	err := Put(ctx, i.cache, key, value, ttl)
+	i.sink.Latency(i.name, "put", i.clock().Sub(start))
+
+	if err != nil {
+		i.sink.Count(i.name, EventError)
+	} else {
+		i.sink.Count(i.name, EventPut)
+	}
+
+	return err
+}
+
+// Take atomically gets and deletes key from the underlying Cache, which must
+// implement Taker.
+func (i *Instrumented[K, T]) Take(ctx context.Context, key K) (T, bool, error) {
+	start := i.clock()
+	value, exists, err := Take(ctx, i.cache, key)
+	i.sink.Latency(i.name, "take", i.clock().Sub(start))
+
+	switch {
+	case err != nil:
+		i.sink.Count(i.name, EventError)
+	case exists:
+		i.sink.Count(i.name, EventHit)
+	default:
+		i.sink.Count(i.name, EventMiss)
+	}
+
+	return value, exists, err
+}
+
+// Add puts key into the underlying Cache only if key does not exist; the Cache
+// must implement Adder.
+func (i *Instrumented[K, T]) Add(ctx context.Context, key K, value T, ttl time.Duration) (bool, error) {
+	start := i.clock()
+	added, err := Add(ctx, i.cache, key, value, ttl)
+	i.sink.Latency(i.name, "add", i.clock().Sub(start))
+
+	switch {
+	case err != nil:
+		i.sink.Count(i.name, EventError)
+	case added:
+		i.sink.Count(i.name, EventPut)
+	default:
+		i.sink.Count(i.name, EventHit)
+	}
+
+	return added, err
+}
+
+func (i *Instrumented[K, T]) DeleteContext(ctx context.Context, key K) error {
+	start := i.clock()
+	err := Delete(ctx, i.cache, key)
+	i.sink.Latency(i.name, "delete", i.clock().Sub(start))
+
+	if err != nil {
+		i.sink.Count(i.name, EventError)
+	} else {
+		i.sink.Count(i.name, EventDelete)
+	}
+
+	return err
+}
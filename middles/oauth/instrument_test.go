@@ -0,0 +1,146 @@
+package oauth
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/shoenig/go-conceal"
+	"github.com/shoenig/test/must"
+)
+
+var (
+	_ ContextCache[string, int] = (*Instrumented[string, int])(nil)
+	_ Observable                = (*VolatileCache[int])(nil)
+	_ Observable                = (*ShardedCache[int])(nil)
+)
+
+// recordingSink records every measurement
+type recordingSink struct {
+	lock      sync.Mutex
+	counts    map[string]int
+	latencies map[string]time.Duration
+}
+
+func newRecordingSink() *recordingSink {
+	return &recordingSink{
+		counts:    make(map[string]int),
+		latencies: make(map[string]time.Duration),
+	}
+}
+
+func (rs *recordingSink) Count(name string, event Event) {
+	rs.lock.Lock()
+	defer rs.lock.Unlock()
+	rs.counts[name+"."+event.String()]++
+}
+
+func (rs *recordingSink) Latency(name string, operation string, elapsed time.Duration) {
+	rs.lock.Lock()
+	defer rs.lock.Unlock()
+	rs.latencies[name+"."+operation] += elapsed
+}
+
+func TestInstrument_VolatileCache(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	vc := NewVolatileCache[int](2)
+	vc.clock = func() time.Time { return now }
+
+	sink := newRecordingSink()
+	c := Instrument("test", vc, sink)
+
+	// each clock reading advances by one millisecond
+	c.clock = func() time.Time {
+		now = now.Add(1 * time.Millisecond)
+		return now
+	}
+
+	c.Put("a", 1, 1*time.Minute)
+	c.Put("b", 2, 1*time.Hour)
+	_, _ = c.Get("a")       // hit
+	_, _ = c.Get("missing") // miss
+	c.Put("c", 3, 1*time.Hour)
+	_, _ = c.Get("b") // evicted by c
+
+	now = now.Add(2 * time.Hour)
+	_, _ = c.Get("a") // expired
+	must.NoError(t, Delete(context.Background(), c, "c"))
+
+	must.MapEq(t, map[string]int{
+		"test.put":    3,
+		"test.hit":    1,
+		"test.miss":   3,
+		"test.evict":  1,
+		"test.expire": 1,
+		"test.delete": 1,
+	}, sink.counts)
+
+	must.MapEq(t, map[string]time.Duration{
+		"test.get":    4 * time.Millisecond,
+		"test.put":    3 * time.Millisecond,
+		"test.delete": 1 * time.Millisecond,
+	}, sink.latencies)
+}
+
+func TestInstrument_Take(t *testing.T) {
+	t.Parallel()
+
+	sink := newRecordingSink()
+	c := Instrument("test", NewVolatileCache[int](size), sink)
+
+	c.Put("a", 1, 1*time.Minute)
+	_, _, _ = c.Take(context.Background(), "a") // hit
+	_, _, _ = c.Take(context.Background(), "a") // miss
+
+	must.Eq(t, 1, sink.counts["test.hit"])
+	must.Eq(t, 1, sink.counts["test.miss"])
+	must.MapContainsKey(t, sink.latencies, "test.take")
+}
+
+func TestInstrument_errors(t *testing.T) {
+	t.Parallel()
+
+	sink := newRecordingSink()
+	c := Instrument[string, string]("broken", new(failingCache), sink)
+
+	_, _ = c.Get("a")
+	c.Put("a", "b", time.Minute)
+	must.MapEq(t, map[string]int{"broken.error": 2}, sink.counts)
+}
+
+func TestInstrument_twice(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	vc := NewVolatileCache[int](1)
+	vc.clock = func() time.Time { return now }
+
+	sink1, sink2 := newRecordingSink(), newRecordingSink()
+	c1 := Instrument("one", vc, sink1)
+	c2 := Instrument("two", vc, sink2)
+
+	c1.Put("a", 1, time.Hour)
+	c2.Put("b", 2, time.Hour) // evicts a
+
+	// both observers see the eviction
+	must.Eq(t, 1, sink1.counts["one.evict"])
+	must.Eq(t, 1, sink2.counts["two.evict"])
+}
+
+func TestInstrument_Sessions(t *testing.T) {
+	t.Parallel()
+
+	cache := TextKeys(NewVolatileCache[rowid](size))
+
+	// not instrumented unless asked
+	plain := NewSessions(&CookieFactory[rowid]{Clock: testNow}, cache)
+	must.Eq[Cache[*conceal.Text, rowid]](t, cache, plain.Cache)
+
+	sink := newRecordingSink()
+	sessions := NewSessions(&CookieFactory[rowid]{Clock: testNow}, Instrument("sessions", cache, sink))
+	_ = sessions.Match(1, conceal.UUIDv4())
+	must.Eq(t, 1, sink.counts["sessions.miss"])
+}
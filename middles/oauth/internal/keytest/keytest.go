@@ -0,0 +1,63 @@
+// Package keytest provides test helpers shared by the validators of the oauth
+// providers.
+package keytest
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"cattlecloud.net/go/webtools/middles/oauth/jwks"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/shoenig/test/must"
+)
+
+// RS256Only checks that the validator created by newValidator from a
+// jwks.KeySet accepts a token of claims signed with RS256, and rejects a
+// token of claims signed with EdDSA, though the key set serves both keys.
+func RS256Only(t *testing.T, newValidator func(*jwks.KeySet) func(token string) error, claims jwt.Claims) {
+	t.Helper()
+
+	rsaPrivate, err := rsa.GenerateKey(rand.Reader, 2048)
+	must.NoError(t, err)
+	edPublic, edPrivate, err := ed25519.GenerateKey(rand.Reader)
+	must.NoError(t, err)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"keys": []map[string]string{{
+				"kid": "rsa-1",
+				"kty": "RSA",
+				"n":   base64.RawURLEncoding.EncodeToString(rsaPrivate.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(rsaPrivate.E)).Bytes()),
+			}, {
+				"kid": "ed-1",
+				"kty": "OKP",
+				"crv": "Ed25519",
+				"x":   base64.RawURLEncoding.EncodeToString(edPublic),
+			}},
+		})
+	}))
+	t.Cleanup(ts.Close)
+
+	validate := newValidator(jwks.New(ts.URL, jwks.SetHTTP(ts.Client())))
+
+	sign := func(method jwt.SigningMethod, kid string, key any) string {
+		token := jwt.NewWithClaims(method, claims)
+		token.Header["kid"] = kid
+		signed, serr := token.SignedString(key)
+		must.NoError(t, serr)
+		return signed
+	}
+
+	must.NoError(t, validate(sign(jwt.SigningMethodRS256, "rsa-1", rsaPrivate)))
+
+	err = validate(sign(jwt.SigningMethodEdDSA, "ed-1", edPrivate))
+	must.ErrorContains(t, err, "signing method EdDSA is invalid")
+}
@@ -0,0 +1,289 @@
+package jwks
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+var (
+	// ErrKeyNotSupported indicates a key is of a type, curve, or use which is
+	// not supported.
+	ErrKeyNotSupported = errors.New("oauth/jwks: key not supported")
+
+	// ErrKeyNotValid indicates a key is malformed.
+	ErrKeyNotValid = errors.New("oauth/jwks: key not valid")
+)
+
+// Key is a parsed JSON Web Key (RFC 7517).
+type Key struct {
+	// ID is the kid of the key.
+	ID string
+
+	// Use is the intended use of the key, e.g. sig, if set.
+	Use string
+
+	// Algorithm is the algorithm intended for use with the key, e.g. RS256,
+	// if set.
+	Algorithm string
+
+	// Public is the public key, one of *rsa.PublicKey, *ecdsa.PublicKey, or
+	// ed25519.PublicKey.
+	Public crypto.PublicKey
+}
+
+// jwk is the JSON encoding of a Key
+type jwk struct {
+	Kid string   `json:"kid"`
+	Kty string   `json:"kty"`
+	Use string   `json:"use"`
+	Alg string   `json:"alg"`
+	X5c []string `json:"x5c"`
+
+	// RSA keys
+	N string `json:"n"`
+	E string `json:"e"`
+
+	// EC and OKP keys
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// ParseKey parses the JSON encoding of a single public JWK. Supported are
+// keys of type RSA, EC (P-256, P-384, P-521), and OKP (Ed25519), along with
+// keys given by an x5c certificate chain.
+func ParseKey(b []byte) (*Key, error) {
+	var raw jwk
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrKeyNotValid, err)
+	}
+	return raw.parse()
+}
+
+// ParseSet parses the JSON encoding of a JWK Set, returning the keys intended
+// for verifying signatures. As recommended by RFC 7517, keys which are not
+// supported or are malformed are skipped; only a malformed set is an error.
+func ParseSet(b []byte) ([]*Key, error) {
+	var set struct {
+		Keys []*jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(b, &set); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrKeyNotValid, err)
+	}
+
+	keys := make([]*Key, 0, len(set.Keys))
+	for _, raw := range set.Keys {
+		key, err := raw.parse()
+		switch {
+		case errors.Is(err, ErrKeyNotSupported), errors.Is(err, ErrKeyNotValid):
+			continue
+		case err != nil:
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
+
+func (k *jwk) parse() (*Key, error) {
+	switch {
+	case k.Use != "" && k.Use != "sig":
+		return nil, fmt.Errorf("%w: use %q", ErrKeyNotSupported, k.Use)
+	case k.Kty != "RSA" && k.Kty != "EC" && k.Kty != "OKP":
+		return nil, fmt.Errorf("%w: key type %q", ErrKeyNotSupported, k.Kty)
+	}
+
+	var (
+		public crypto.PublicKey
+		err    error
+	)
+
+	// the key is given by its parameters, an x5c certificate chain, or both
+	if k.parameters() || len(k.X5c) == 0 {
+		if public, err = k.public(); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(k.X5c) > 0 {
+		certified, cerr := chain(k.Kty, k.X5c)
+		if cerr != nil {
+			return nil, cerr
+		}
+		if public != nil && !equal(public, certified) {
+			return nil, fmt.Errorf("%w: x5c does not match key", ErrKeyNotValid)
+		}
+		public = certified
+	}
+
+	return &Key{
+		ID:        k.Kid,
+		Use:       k.Use,
+		Algorithm: k.Alg,
+		Public:    public,
+	}, nil
+}
+
+// parameters returns whether any key parameters are set
+func (k *jwk) parameters() bool {
+	return k.N != "" || k.E != "" || k.X != "" || k.Y != ""
+}
+
+// public returns the key described by the key parameters
+func (k *jwk) public() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		return k.rsa()
+	case "EC":
+		return k.ec()
+	case "OKP":
+		return k.okp()
+	default:
+		return nil, fmt.Errorf("%w: key type %q", ErrKeyNotSupported, k.Kty)
+	}
+}
+
+func (k *jwk) rsa() (*rsa.PublicKey, error) {
+	n, err := decode(k.N)
+	if err != nil {
+		return nil, err
+	}
+	e, err := decode(k.E)
+	if err != nil {
+		return nil, err
+	}
+
+	exponent := new(big.Int).SetBytes(e)
+	if len(n) == 0 || !exponent.IsInt64() || exponent.Int64() < 3 || exponent.Int64() > 1<<31-1 {
+		return nil, fmt.Errorf("%w: rsa parameters", ErrKeyNotValid)
+	}
+
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}, nil
+}
+
+func (k *jwk) ec() (*ecdsa.PublicKey, error) {
+	var curve elliptic.Curve
+	switch k.Crv {
+	case "P-256":
+		curve = elliptic.P256()
+	case "P-384":
+		curve = elliptic.P384()
+	case "P-521":
+		curve = elliptic.P521()
+	default:
+		return nil, fmt.Errorf("%w: curve %q", ErrKeyNotSupported, k.Crv)
+	}
+
+	x, err := decode(k.X)
+	if err != nil {
+		return nil, err
+	}
+	y, err := decode(k.Y)
+	if err != nil {
+		return nil, err
+	}
+
+	size := (curve.Params().BitSize + 7) / 8
+	if len(x) != size || len(y) != size {
+		return nil, fmt.Errorf("%w: ec point size", ErrKeyNotValid)
+	}
+
+	// parsing the uncompressed point checks the point is on the curve
+	point := make([]byte, 0, 1+2*size)
+	point = append(point, 4)
+	point = append(point, x...)
+	point = append(point, y...)
+
+	public, err := ecdsa.ParseUncompressedPublicKey(curve, point)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrKeyNotValid, err)
+	}
+	return public, nil
+}
+
+func (k *jwk) okp() (ed25519.PublicKey, error) {
+	if k.Crv != "Ed25519" {
+		return nil, fmt.Errorf("%w: curve %q", ErrKeyNotSupported, k.Crv)
+	}
+
+	x, err := decode(k.X)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(x) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("%w: ed25519 key size", ErrKeyNotValid)
+	}
+
+	return ed25519.PublicKey(x), nil
+}
+
+// chain parses an x5c certificate chain, returning the public key of the first
+// certificate, which must be of type kty. Each certificate must be signed by
+// the next in the chain; the chain is not checked against any root
+// certificates.
+func chain(kty string, x5c []string) (crypto.PublicKey, error) {
+	certificates := make([]*x509.Certificate, 0, len(x5c))
+	for _, encoded := range x5c {
+		// unlike other members, x5c is standard base64 encoded
+		der, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("%w: x5c: %w", ErrKeyNotValid, err)
+		}
+		certificate, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, fmt.Errorf("%w: x5c: %w", ErrKeyNotValid, err)
+		}
+		certificates = append(certificates, certificate)
+	}
+
+	for i := range len(certificates) - 1 {
+		if err := certificates[i].CheckSignatureFrom(certificates[i+1]); err != nil {
+			return nil, fmt.Errorf("%w: x5c: %w", ErrKeyNotValid, err)
+		}
+	}
+
+	public := certificates[0].PublicKey
+	switch public.(type) {
+	case *rsa.PublicKey:
+		if kty == "RSA" {
+			return public, nil
+		}
+	case *ecdsa.PublicKey:
+		if kty == "EC" {
+			return public, nil
+		}
+	case ed25519.PublicKey:
+		if kty == "OKP" {
+			return public, nil
+		}
+	default:
+		return nil, fmt.Errorf("%w: x5c key type %T", ErrKeyNotSupported, public)
+	}
+
+	return nil, fmt.Errorf("%w: x5c key type %T is not %q", ErrKeyNotValid, public, kty)
+}
+
+// equal returns whether public keys a and b are the same
+func equal(a, b crypto.PublicKey) bool {
+	e, ok := a.(interface{ Equal(crypto.PublicKey) bool })
+	return ok && e.Equal(b)
+}
+
+func decode(s string) ([]byte, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrKeyNotValid, err)
+	}
+	return b, nil
+}
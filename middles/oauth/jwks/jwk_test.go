@@ -0,0 +1,240 @@
+package jwks
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/shoenig/test/must"
+)
+
+func encode(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// encodeKey returns the JWK of public
+func encodeKey(t *testing.T, kid string, public crypto.PublicKey) map[string]any {
+	switch key := public.(type) {
+	case *rsa.PublicKey:
+		return map[string]any{
+			"kid": kid,
+			"kty": "RSA",
+			"n":   encode(key.N.Bytes()),
+			"e":   encode(big.NewInt(int64(key.E)).Bytes()),
+		}
+	case *ecdsa.PublicKey:
+		point, err := key.Bytes()
+		must.NoError(t, err)
+		size := (len(point) - 1) / 2
+		return map[string]any{
+			"kid": kid,
+			"kty": "EC",
+			"crv": key.Curve.Params().Name,
+			"x":   encode(point[1 : 1+size]),
+			"y":   encode(point[1+size:]),
+		}
+	case ed25519.PublicKey:
+		return map[string]any{
+			"kid": kid,
+			"kty": "OKP",
+			"crv": "Ed25519",
+			"x":   encode(key),
+		}
+	default:
+		t.Fatalf("unexpected key type %T", public)
+		return nil
+	}
+}
+
+func parse(t *testing.T, m map[string]any) (*Key, error) {
+	b, err := json.Marshal(m)
+	must.NoError(t, err)
+	return ParseKey(b)
+}
+
+func TestParseKey(t *testing.T) {
+	t.Parallel()
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	must.NoError(t, err)
+
+	cases := []struct {
+		name   string
+		public crypto.PublicKey
+	}{
+		{name: "RSA", public: &rsaKey.PublicKey},
+		{name: "P-256", public: ecKey(t, elliptic.P256())},
+		{name: "P-384", public: ecKey(t, elliptic.P384())},
+		{name: "P-521", public: ecKey(t, elliptic.P521())},
+		{name: "Ed25519", public: edKey(t)},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			m := encodeKey(t, "kid-1", tc.public)
+			m["use"] = "sig"
+			m["alg"] = "test-alg"
+
+			key, perr := parse(t, m)
+			must.NoError(t, perr)
+			must.Eq(t, "kid-1", key.ID)
+			must.Eq(t, "sig", key.Use)
+			must.Eq(t, "test-alg", key.Algorithm)
+			must.True(t, equal(tc.public, key.Public))
+		})
+	}
+}
+
+func TestParseKey_notValid(t *testing.T) {
+	t.Parallel()
+
+	public := ecKey(t, elliptic.P256()).(*ecdsa.PublicKey)
+	good := encodeKey(t, "kid-1", public)
+
+	cases := []struct {
+		name string
+		m    map[string]any
+		exp  error
+	}{
+		{name: "use", m: map[string]any{"kty": "RSA", "use": "enc"}, exp: ErrKeyNotSupported},
+		{name: "kty", m: map[string]any{"kty": "oct", "k": "c2VjcmV0"}, exp: ErrKeyNotSupported},
+		{name: "curve", m: map[string]any{"kty": "EC", "crv": "secp256k1"}, exp: ErrKeyNotSupported},
+		{name: "okp curve", m: map[string]any{"kty": "OKP", "crv": "X25519"}, exp: ErrKeyNotSupported},
+		{name: "rsa missing", m: map[string]any{"kty": "RSA"}, exp: ErrKeyNotValid},
+		{name: "rsa exponent", m: map[string]any{"kty": "RSA", "n": "AQAB", "e": "AQ"}, exp: ErrKeyNotValid},
+		{name: "encoding", m: map[string]any{"kty": "OKP", "crv": "Ed25519", "x": "not base64!"}, exp: ErrKeyNotValid},
+		{name: "ed25519 size", m: map[string]any{"kty": "OKP", "crv": "Ed25519", "x": "AQAB"}, exp: ErrKeyNotValid},
+		{name: "ec size", m: map[string]any{"kty": "EC", "crv": "P-256", "x": good["x"], "y": "AQAB"}, exp: ErrKeyNotValid},
+		{name: "ec point", m: map[string]any{"kty": "EC", "crv": "P-256", "x": good["x"], "y": good["x"]}, exp: ErrKeyNotValid},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := parse(t, tc.m)
+			must.ErrorIs(t, err, tc.exp)
+		})
+	}
+}
+
+func TestParseKey_x5c(t *testing.T) {
+	t.Parallel()
+
+	root, rootKey := certificate(t, nil, nil)
+	leaf, leafKey := certificate(t, root, rootKey)
+	other, _ := certificate(t, nil, nil)
+
+	x5c := func(certificates ...*x509.Certificate) []string {
+		encoded := make([]string, 0, len(certificates))
+		for _, c := range certificates {
+			encoded = append(encoded, base64.StdEncoding.EncodeToString(c.Raw))
+		}
+		return encoded
+	}
+
+	t.Run("chain only", func(t *testing.T) {
+		key, err := parse(t, map[string]any{"kid": "kid-1", "kty": "EC", "x5c": x5c(leaf, root)})
+		must.NoError(t, err)
+		must.True(t, equal(leafKey.Public(), key.Public))
+	})
+
+	t.Run("chain and parameters", func(t *testing.T) {
+		m := encodeKey(t, "kid-1", leafKey.Public())
+		m["x5c"] = x5c(leaf, root)
+		key, err := parse(t, m)
+		must.NoError(t, err)
+		must.True(t, equal(leafKey.Public(), key.Public))
+	})
+
+	t.Run("mismatch", func(t *testing.T) {
+		m := encodeKey(t, "kid-1", ecKey(t, elliptic.P256()))
+		m["x5c"] = x5c(leaf)
+		_, err := parse(t, m)
+		must.ErrorIs(t, err, ErrKeyNotValid)
+	})
+
+	t.Run("broken chain", func(t *testing.T) {
+		_, err := parse(t, map[string]any{"kty": "EC", "x5c": x5c(leaf, other)})
+		must.ErrorIs(t, err, ErrKeyNotValid)
+	})
+
+	t.Run("wrong type", func(t *testing.T) {
+		_, err := parse(t, map[string]any{"kty": "RSA", "x5c": x5c(leaf)})
+		must.ErrorIs(t, err, ErrKeyNotValid)
+	})
+}
+
+func TestParseSet(t *testing.T) {
+	t.Parallel()
+
+	b, err := json.Marshal(map[string]any{
+		"keys": []map[string]any{
+			encodeKey(t, "kid-1", ecKey(t, elliptic.P256())),
+			{"kid": "kid-2", "kty": "RSA", "use": "enc"}, // skipped
+			{"kid": "kid-3", "kty": "oct"},               // skipped
+			{"kid": "kid-4", "kty": "RSA", "n": "AQAB"},  // skipped
+			encodeKey(t, "kid-5", edKey(t)),
+		},
+	})
+	must.NoError(t, err)
+
+	keys, err := ParseSet(b)
+	must.NoError(t, err)
+	must.SliceLen(t, 2, keys)
+	must.Eq(t, "kid-1", keys[0].ID)
+	must.Eq(t, "kid-5", keys[1].ID)
+
+	t.Run("malformed", func(t *testing.T) {
+		_, err2 := ParseSet([]byte(`{"keys":{}}`))
+		must.ErrorIs(t, err2, ErrKeyNotValid)
+	})
+}
+
+func ecKey(t *testing.T, curve elliptic.Curve) crypto.PublicKey {
+	key, err := ecdsa.GenerateKey(curve, rand.Reader)
+	must.NoError(t, err)
+	return &key.PublicKey
+}
+
+func edKey(t *testing.T) crypto.PublicKey {
+	public, _, err := ed25519.GenerateKey(rand.Reader)
+	must.NoError(t, err)
+	return public
+}
+
+// certificate creates a certificate signed by parent, or self-signed if
+// parent is nil
+func certificate(t *testing.T, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	must.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test"},
+		NotBefore:             time.Now().Add(-1 * time.Hour),
+		NotAfter:              time.Now().Add(1 * time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  parent == nil,
+	}
+
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	must.NoError(t, err)
+
+	c, err := x509.ParseCertificate(der)
+	must.NoError(t, err)
+	return c, key
+}
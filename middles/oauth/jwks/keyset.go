@@ -0,0 +1,116 @@
+// Package jwks provides parsing of JSON Web Keys (RFC 7517), and a KeySet which
+// fetches and caches the public keys of an OAuth provider.
+package jwks
+
+import (
+	"context"
+	"crypto"
+	"net/http"
+	"time"
+
+	"cattlecloud.net/go/webtools/middles/oauth"
+	"cattlecloud.net/go/webtools/middles/oauth/keyfetch"
+)
+
+// ErrKeyNotFound indicates no key of the requested kid exists in the key set.
+var ErrKeyNotFound = keyfetch.ErrKeyNotFound
+
+type Options struct {
+	cache      oauth.Cache[string, crypto.PublicKey]
+	httpClient *http.Client
+	ttl        time.Duration
+	fetcher    *keyfetch.Fetcher
+}
+
+type OptionFunc func(*Options)
+
+func SetHTTP(client *http.Client) OptionFunc {
+	return func(o *Options) { o.httpClient = client }
+}
+
+func SetCache(c oauth.Cache[string, crypto.PublicKey]) OptionFunc {
+	return func(o *Options) { o.cache = c }
+}
+
+// SetTTL sets how long keys are cached, overriding the caching headers of the
+// endpoint. By default keys are cached for as long as the endpoint allows.
+func SetTTL(ttl time.Duration) OptionFunc {
+	return func(o *Options) { o.ttl = ttl }
+}
+
+// SetFetcher sets the keyfetch.Fetcher of the JWK Set, e.g. to change the
+// bounds of how long keys are cached. By default the JWK Set of the endpoint is
+// fetched using the http client of the KeySet.
+func SetFetcher(f *keyfetch.Fetcher) OptionFunc {
+	return func(o *Options) { o.fetcher = f }
+}
+
+// New creates a KeySet of the keys published as a JWK Set at endpoint, e.g.
+// https://appleid.apple.com/auth/keys
+func New(endpoint string, opts ...OptionFunc) *KeySet {
+	options := &Options{
+		cache:      oauth.NewVolatileCache[crypto.PublicKey](32),
+		httpClient: &http.Client{Timeout: 1 * time.Minute},
+	}
+
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	if options.fetcher == nil {
+		options.fetcher = keyfetch.New(endpoint, keyfetch.SetHTTP(options.httpClient))
+	}
+
+	return &KeySet{
+		vc:  oauth.NewLoadingCache(options.cache),
+		kf:  options.fetcher,
+		ttl: options.ttl,
+	}
+}
+
+// KeySet provides the public keys of a JWK Set endpoint by kid, caching each
+// parsed crypto.PublicKey. Keys are fetched when a kid is not in the cache.
+type KeySet struct {
+	vc  *oauth.LoadingCache[crypto.PublicKey]
+	kf  *keyfetch.Fetcher
+	ttl time.Duration
+}
+
+// Key returns the public key of keyID.
+func (ks *KeySet) Key(ctx context.Context, keyID string) (crypto.PublicKey, error) {
+	// concurrent lookups of the same missing key result in one fetch
+	return ks.vc.GetOrLoad(ctx, keyID, func(ctx context.Context) (crypto.PublicKey, time.Duration, error) {
+		key, ttl, err := keyfetch.Load(ctx, ks.kf, keyID, ks.parse)
+		return key, ks.keyTTL(ttl), err
+	})
+}
+
+// Health returns how fresh the keys of the JWK Set are.
+func (ks *KeySet) Health() keyfetch.Health {
+	return ks.kf.Health()
+}
+
+// parse finds the key of keyID in the JWK Set of body, putting the other keys
+// into the cache
+func (ks *KeySet) parse(ctx context.Context, body []byte, keyID string, ttl time.Duration) (crypto.PublicKey, bool, error) {
+	keys, err := ParseSet(body)
+	if err != nil {
+		return nil, false, err
+	}
+
+	public := make(map[string]crypto.PublicKey, len(keys))
+	for _, key := range keys {
+		public[key.ID] = key.Public
+	}
+
+	key, found := keyfetch.Pick(ctx, ks.vc, public, keyID, ks.keyTTL(ttl))
+	return key, found, nil
+}
+
+// keyTTL returns how long keys are cached, given the ttl of the JWK Set
+func (ks *KeySet) keyTTL(ttl time.Duration) time.Duration {
+	if ks.ttl > 0 {
+		return ks.ttl
+	}
+	return ttl
+}
@@ -0,0 +1,85 @@
+package jwks
+
+import (
+	"context"
+	"crypto"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/shoenig/test/must"
+)
+
+func TestKeySet_Key(t *testing.T) {
+	t.Parallel()
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	must.NoError(t, err)
+
+	cases := []struct {
+		kid    string
+		public crypto.PublicKey
+	}{
+		{kid: "RSA", public: &rsaKey.PublicKey},
+		{kid: "P-256", public: ecKey(t, elliptic.P256())},
+		{kid: "P-384", public: ecKey(t, elliptic.P384())},
+		{kid: "P-521", public: ecKey(t, elliptic.P521())},
+		{kid: "Ed25519", public: edKey(t)},
+	}
+
+	// keys which are not supported or are malformed are skipped
+	keys := []map[string]any{
+		{"kid": "enc", "kty": "RSA", "use": "enc"},
+		{"kid": "malformed", "kty": "RSA", "n": "AQAB"},
+	}
+	for _, tc := range cases {
+		keys = append(keys, encodeKey(t, tc.kid, tc.public))
+	}
+
+	var requests atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		requests.Add(1)
+		_ = json.NewEncoder(w).Encode(map[string]any{"keys": keys})
+	}))
+	t.Cleanup(ts.Close)
+
+	ks := New(ts.URL, SetHTTP(ts.Client()))
+	ctx := context.Background()
+
+	for _, tc := range cases {
+		t.Run(tc.kid, func(t *testing.T) {
+			key, kerr := ks.Key(ctx, tc.kid)
+			must.NoError(t, kerr)
+			must.True(t, equal(tc.public, key))
+		})
+	}
+
+	// every key of the set was cached by the same fetch
+	must.Eq(t, 1, requests.Load())
+
+	// skipped and unknown keys are rejected without fetching again so soon
+	for _, kid := range []string{"enc", "malformed", "unknown"} {
+		_, err = ks.Key(ctx, kid)
+		must.ErrorIs(t, err, ErrKeyNotFound)
+	}
+	must.Eq(t, 1, requests.Load())
+}
+
+func TestKeySet_Key_status(t *testing.T) {
+	t.Parallel()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(ts.Close)
+
+	ks := New(ts.URL, SetHTTP(ts.Client()))
+	_, err := ks.Key(context.Background(), "kid-1")
+	must.ErrorContains(t, err, "unexpected status 503")
+	must.ErrorContains(t, ks.Health().Err, "unexpected status 503")
+}
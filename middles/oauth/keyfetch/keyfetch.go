@@ -0,0 +1,301 @@
+// Package keyfetch provides a Fetcher of the documents in which OAuth
+// providers publish their public keys, honoring the HTTP caching headers of
+// the provider.
+package keyfetch
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"cattlecloud.net/go/webtools/middles/oauth"
+)
+
+type Options struct {
+	httpClient *http.Client
+	minTTL     time.Duration
+	maxTTL     time.Duration
+	defaultTTL time.Duration
+	interval   time.Duration
+	negative   time.Duration
+	grace      time.Duration
+	clock      func() time.Time
+}
+
+type OptionFunc func(*Options)
+
+func SetHTTP(client *http.Client) OptionFunc {
+	return func(o *Options) { o.httpClient = client }
+}
+
+// SetBounds sets the minimum and maximum TTL of a fetched document, whatever
+// the provider says. The default bounds are one minute and 24 hours.
+func SetBounds(minTTL, maxTTL time.Duration) OptionFunc {
+	return func(o *Options) {
+		o.minTTL = minTTL
+		o.maxTTL = maxTTL
+	}
+}
+
+// SetDefaultTTL sets the TTL of a fetched document for which the provider
+// sets no caching headers. The default is one hour.
+func SetDefaultTTL(ttl time.Duration) OptionFunc {
+	return func(o *Options) { o.defaultTTL = ttl }
+}
+
+// SetRefetchInterval sets the minimum interval between fetches of the document
+// made by Load to find a key that is not cached. The default is one minute.
+func SetRefetchInterval(interval time.Duration) OptionFunc {
+	return func(o *Options) { o.interval = interval }
+}
+
+// SetNegativeTTL sets how long a key found to be missing from the document is
+// rejected by Load without fetching the document. The default is five minutes.
+func SetNegativeTTL(ttl time.Duration) OptionFunc {
+	return func(o *Options) { o.negative = ttl }
+}
+
+// SetStaleGrace sets how long past its expiration the most recent document is
+// used by Load while fetching the document fails, such that a provider outage
+// does not lock out users. The default is six hours.
+func SetStaleGrace(grace time.Duration) OptionFunc {
+	return func(o *Options) { o.grace = grace }
+}
+
+// New creates a Fetcher of the document at endpoint.
+func New(endpoint string, opts ...OptionFunc) *Fetcher {
+	options := &Options{
+		httpClient: &http.Client{Timeout: 1 * time.Minute},
+		minTTL:     1 * time.Minute,
+		maxTTL:     24 * time.Hour,
+		defaultTTL: 1 * time.Hour,
+		interval:   1 * time.Minute,
+		negative:   5 * time.Minute,
+		grace:      6 * time.Hour,
+		clock:      time.Now,
+	}
+
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	f := &Fetcher{
+		url:        endpoint,
+		hc:         options.httpClient,
+		minTTL:     options.minTTL,
+		maxTTL:     options.maxTTL,
+		defaultTTL: options.defaultTTL,
+		interval:   options.interval,
+		negative:   options.negative,
+		grace:      options.grace,
+		clock:      options.clock,
+		refetch:    new(sync.Mutex),
+		lock:       new(sync.Mutex),
+	}
+
+	// keys found missing expire by the clock of the fetcher
+	f.unknown = oauth.NewVolatileCache[bool](1024, oauth.Clock(func() time.Time { return f.clock() }))
+
+	return f
+}
+
+// Fetcher fetches a document of public keys (e.g. a JWK Set), along with how
+// long the document may be cached.
+//
+// The TTL is taken from the Cache-Control max-age directive, falling back to
+// the Expires header, and is clamped to the bounds of the Fetcher. Documents
+// are revalidated by ETag, such that an unchanged document is not downloaded
+// again.
+type Fetcher struct {
+	url        string
+	hc         *http.Client
+	minTTL     time.Duration
+	maxTTL     time.Duration
+	defaultTTL time.Duration
+	interval   time.Duration
+	negative   time.Duration
+	grace      time.Duration
+	clock      func() time.Time
+
+	unknown *oauth.VolatileCache[bool] // keys recently found missing
+	refetch *sync.Mutex                // serializes Load
+
+	lock    *sync.Mutex
+	etag    string
+	body    []byte
+	fetched time.Time // of the most recent attempt
+	updated time.Time // of the most recent success
+	expires time.Time // of the most recent document
+	err     error     // of the most recent attempt
+}
+
+// Health describes how fresh the document of a Fetcher is.
+type Health struct {
+	// Updated is when the document was last fetched successfully.
+	Updated time.Time
+
+	// Expires is when the most recent document expired, or will expire.
+	Expires time.Time
+
+	// Staleness is how long ago the most recent document expired, or zero if
+	// the document has not expired.
+	Staleness time.Duration
+
+	// Err is the error of the most recent fetch, if it failed.
+	Err error
+}
+
+// Stale reports whether the most recent document has expired.
+func (h Health) Stale() bool {
+	return h.Staleness > 0
+}
+
+// Health returns how fresh the document of f is, e.g. to be reported by a
+// health check of the service.
+func (f *Fetcher) Health() Health {
+	now := f.clock()
+
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	return Health{
+		Updated:   f.updated,
+		Expires:   f.expires,
+		Staleness: max(now.Sub(f.expires), 0),
+		Err:       f.err,
+	}
+}
+
+// Fetch the document, returning its content and the duration for which the
+// content may be cached.
+func (f *Fetcher) Fetch(ctx context.Context) ([]byte, time.Duration, error) {
+	body, ttl, err := f.fetch(ctx)
+
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	f.err = err
+	if err == nil {
+		f.updated = f.clock()
+	}
+
+	return body, ttl, err
+}
+
+func (f *Fetcher) fetch(ctx context.Context) ([]byte, time.Duration, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, f.url, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	f.lock.Lock()
+	etag, previous := f.etag, f.body
+	f.fetched = f.clock()
+	f.lock.Unlock()
+
+	if etag != "" {
+		request.Header.Set("If-None-Match", etag)
+	}
+
+	response, err := f.hc.Do(request)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer func() { _ = response.Body.Close() }()
+
+	now := f.clock()
+	ttl := f.TTL(now, response.Header)
+
+	switch {
+	case response.StatusCode == http.StatusNotModified && previous != nil:
+		// the document is unchanged; only the ttl is refreshed
+		f.lock.Lock()
+		f.expires = now.Add(ttl)
+		f.lock.Unlock()
+		return previous, ttl, nil
+	case response.StatusCode != http.StatusOK:
+		return nil, 0, fmt.Errorf("oauth/keyfetch: unexpected status %d", response.StatusCode)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(response.Body, 1<<20))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	f.lock.Lock()
+	if directives(response.Header)["no-store"] {
+		f.etag, f.body = "", nil
+	} else {
+		f.etag, f.body = response.Header.Get("ETag"), body
+	}
+	f.expires = now.Add(ttl)
+	f.lock.Unlock()
+
+	return body, ttl, nil
+}
+
+// TTL returns how long a response with header may be cached, as of now.
+func (f *Fetcher) TTL(now time.Time, header http.Header) time.Duration {
+	return min(max(f.ttl(now, header), f.minTTL), f.maxTTL)
+}
+
+func (f *Fetcher) ttl(now time.Time, header http.Header) time.Duration {
+	cc := directives(header)
+
+	// the document must not be reused without asking the provider, which is
+	// as often as the bounds allow
+	if cc["no-store"] || cc["no-cache"] {
+		return 0
+	}
+
+	if maxAge, ok := maxAge(header); ok {
+		age, _ := strconv.Atoi(header.Get("Age"))
+		return time.Duration(maxAge-max(age, 0)) * time.Second
+	}
+
+	if expires, err := http.ParseTime(header.Get("Expires")); err == nil {
+		// measure against the clock of the provider, if it says
+		if date, derr := http.ParseTime(header.Get("Date")); derr == nil {
+			now = date
+		}
+		return expires.Sub(now)
+	}
+
+	return f.defaultTTL
+}
+
+// directives returns the set of Cache-Control directives of header, without
+// their arguments
+func directives(header http.Header) map[string]bool {
+	result := make(map[string]bool)
+	for _, value := range header.Values("Cache-Control") {
+		for directive := range strings.SplitSeq(value, ",") {
+			name, _, _ := strings.Cut(strings.TrimSpace(directive), "=")
+			result[strings.ToLower(name)] = true
+		}
+	}
+	return result
+}
+
+// maxAge returns the seconds of the Cache-Control max-age directive of header
+func maxAge(header http.Header) (int, bool) {
+	for _, value := range header.Values("Cache-Control") {
+		for directive := range strings.SplitSeq(value, ",") {
+			name, arg, _ := strings.Cut(strings.TrimSpace(directive), "=")
+			if !strings.EqualFold(name, "max-age") {
+				continue
+			}
+			seconds, err := strconv.Atoi(strings.Trim(arg, `"`))
+			if err != nil || seconds < 0 {
+				return 0, false
+			}
+			return seconds, true
+		}
+	}
+	return 0, false
+}
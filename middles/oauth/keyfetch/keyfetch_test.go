@@ -0,0 +1,178 @@
+package keyfetch
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/shoenig/test/must"
+)
+
+func TestFetcher_TTL(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2024, 10, 31, 13, 50, 10, 0, time.UTC)
+	f := New("https://example.com/keys")
+
+	cases := []struct {
+		name   string
+		header http.Header
+		exp    time.Duration
+	}{
+		{
+			name:   "expires",
+			header: http.Header{"Expires": {"Fri, 01 Nov 2024 00:34:53 GMT"}},
+			exp:    10*time.Hour + 44*time.Minute + 43*time.Second,
+		},
+		{
+			name:   "expires with date",
+			header: http.Header{"Expires": {"Thu, 31 Oct 2024 15:00:00 GMT"}, "Date": {"Thu, 31 Oct 2024 14:00:00 GMT"}},
+			exp:    1 * time.Hour,
+		},
+		{
+			name:   "parse-failure",
+			header: http.Header{"Expires": {"Bob, 01 Nov 2024 00:34:53 GMT"}},
+			exp:    1 * time.Hour, // the fallback cache expiration
+		},
+		{
+			name:   "none",
+			header: http.Header{},
+			exp:    1 * time.Hour,
+		},
+		{
+			name:   "max-age",
+			header: http.Header{"Cache-Control": {"public, max-age=21600, must-revalidate"}},
+			exp:    6 * time.Hour,
+		},
+		{
+			name:   "max-age over expires",
+			header: http.Header{"Cache-Control": {"max-age=7200"}, "Expires": {"Fri, 01 Nov 2024 00:34:53 GMT"}},
+			exp:    2 * time.Hour,
+		},
+		{
+			name:   "max-age less age",
+			header: http.Header{"Cache-Control": {"max-age=7200"}, "Age": {"1800"}},
+			exp:    90 * time.Minute,
+		},
+		{
+			name:   "max-age malformed",
+			header: http.Header{"Cache-Control": {"max-age=soon"}, "Expires": {"Thu, 31 Oct 2024 15:50:10 GMT"}},
+			exp:    2 * time.Hour,
+		},
+		{
+			name:   "no-store",
+			header: http.Header{"Cache-Control": {"no-store, max-age=7200"}},
+			exp:    1 * time.Minute,
+		},
+		{
+			name:   "no-cache",
+			header: http.Header{"Cache-Control": {"no-cache"}},
+			exp:    1 * time.Minute,
+		},
+		{
+			name:   "minimum",
+			header: http.Header{"Cache-Control": {"max-age=5"}},
+			exp:    1 * time.Minute,
+		},
+		{
+			name:   "maximum",
+			header: http.Header{"Cache-Control": {"max-age=31536000"}},
+			exp:    24 * time.Hour,
+		},
+		{
+			name:   "expired",
+			header: http.Header{"Expires": {"Thu, 01 Jan 1970 00:00:00 GMT"}},
+			exp:    1 * time.Minute,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			must.Eq(t, tc.exp, f.TTL(now, tc.header))
+		})
+	}
+
+	t.Run("bounds", func(t *testing.T) {
+		f := New("https://example.com/keys", SetBounds(5*time.Minute, 2*time.Hour), SetDefaultTTL(3*time.Hour))
+		must.Eq(t, 5*time.Minute, f.TTL(now, http.Header{"Cache-Control": {"no-store"}}))
+		must.Eq(t, 2*time.Hour, f.TTL(now, http.Header{}))
+	})
+}
+
+func TestFetcher_Fetch(t *testing.T) {
+	t.Parallel()
+
+	var requests, revalidations atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Header().Set("Cache-Control", "max-age=600")
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			revalidations.Add(1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		_, _ = w.Write([]byte(`{"keys":[]}`))
+	}))
+	t.Cleanup(ts.Close)
+
+	f := New(ts.URL, SetHTTP(ts.Client()))
+	ctx := context.Background()
+
+	body, ttl, err := f.Fetch(ctx)
+	must.NoError(t, err)
+	must.Eq(t, `{"keys":[]}`, string(body))
+	must.Eq(t, 10*time.Minute, ttl)
+	must.Eq(t, 0, revalidations.Load())
+
+	// the second fetch is revalidated, reusing the document
+	body, ttl, err = f.Fetch(ctx)
+	must.NoError(t, err)
+	must.Eq(t, `{"keys":[]}`, string(body))
+	must.Eq(t, 10*time.Minute, ttl)
+	must.Eq(t, 1, revalidations.Load())
+	must.Eq(t, 2, requests.Load())
+}
+
+func TestFetcher_Fetch_noStore(t *testing.T) {
+	t.Parallel()
+
+	var conditional atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") != "" {
+			conditional.Add(1)
+		}
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Set("ETag", `"v1"`)
+		_, _ = w.Write([]byte(`{"keys":[]}`))
+	}))
+	t.Cleanup(ts.Close)
+
+	f := New(ts.URL, SetHTTP(ts.Client()))
+	ctx := context.Background()
+
+	for range 2 {
+		_, ttl, err := f.Fetch(ctx)
+		must.NoError(t, err)
+		must.Eq(t, 1*time.Minute, ttl)
+	}
+
+	// the document was not retained, so it cannot be revalidated
+	must.Eq(t, 0, conditional.Load())
+}
+
+func TestFetcher_Fetch_status(t *testing.T) {
+	t.Parallel()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(ts.Close)
+
+	f := New(ts.URL, SetHTTP(ts.Client()))
+	_, _, err := f.Fetch(context.Background())
+	must.ErrorContains(t, err, "unexpected status 503")
+}
@@ -0,0 +1,169 @@
+package keyfetch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"cattlecloud.net/go/webtools/middles/oauth"
+)
+
+// ErrKeyNotFound indicates no key of the requested kid exists in the document.
+var ErrKeyNotFound = errors.New("oauth/keyfetch: public key not found")
+
+// RejectedError indicates a key was rejected without fetching the document,
+// because the key was recently found to be missing, or because the document
+// was fetched too recently to be fetched again.
+type RejectedError struct {
+	KeyID string
+}
+
+func (e *RejectedError) Error() string {
+	return fmt.Sprintf("oauth/keyfetch: key %q rejected without fetch", e.KeyID)
+}
+
+// Unwrap returns ErrKeyNotFound.
+func (e *RejectedError) Unwrap() error {
+	return ErrKeyNotFound
+}
+
+// Parser finds the key of keyID in the document body, returning false if the
+// document does not contain the key. Other keys of the document may be cached
+// for ttl along the way.
+type Parser[K any] func(ctx context.Context, body []byte, keyID string, ttl time.Duration) (K, bool, error)
+
+// Load returns the key of keyID found in the document of f by parse, along with
+// how long the key may be cached. Load is meant to be called when keyID is not
+// among the cached keys.
+//
+// Since anyone may present a token of any kid, the document is fetched at most
+// once per refetch interval; until then the most recent document is parsed
+// instead. A key missing from a newly fetched document is rejected for the
+// negative TTL of f without parsing or fetching the document. Either way a
+// RejectedError is returned.
+//
+// If fetching the document fails, keys are found in the most recent document
+// until it is expired by longer than the stale grace period of f.
+func Load[K any](ctx context.Context, f *Fetcher, keyID string, parse Parser[K]) (K, time.Duration, error) {
+	var empty K
+
+	if _, unknown := f.unknown.Get(keyID); unknown {
+		return empty, 0, &RejectedError{KeyID: keyID}
+	}
+
+	// serialize loads, such that loads waiting on a fetch make use of the
+	// document it fetched
+	f.refetch.Lock()
+	defer f.refetch.Unlock()
+
+	if recent, ferr := f.attempted(); recent {
+		body, ttl := f.usable()
+		if body == nil {
+			// no document was retained, e.g. because of no-store
+			if ferr != nil {
+				return empty, 0, ferr
+			}
+			return empty, 0, &RejectedError{KeyID: keyID}
+		}
+
+		key, found, err := parse(ctx, body, keyID, ttl)
+		switch {
+		case err != nil:
+			return empty, 0, err
+		case !found && ferr != nil:
+			// the document could not be fetched to find out
+			return empty, 0, ferr
+		case !found:
+			// not recorded as missing, such that a key published since the
+			// document was fetched is found once the interval passes
+			return empty, 0, &RejectedError{KeyID: keyID}
+		}
+		return key, ttl, nil
+	}
+
+	body, ttl, ferr := f.Fetch(ctx)
+	if ferr != nil {
+		// use the most recent document while within the grace period
+		body, ttl = f.usable()
+		if body == nil {
+			return empty, 0, ferr
+		}
+
+		key, found, err := parse(ctx, body, keyID, ttl)
+		if err != nil || !found {
+			return empty, 0, ferr
+		}
+		return key, ttl, nil
+	}
+
+	key, found, err := parse(ctx, body, keyID, ttl)
+	switch {
+	case err != nil:
+		return empty, 0, err
+	case !found:
+		f.missing(keyID)
+		return empty, 0, ErrKeyNotFound
+	}
+	return key, ttl, nil
+}
+
+// Pick returns the key of keyID among keys, which are by kid, for use by a
+// Parser. The other keys are put into cache for ttl, such that each document is
+// parsed once rather than on every validation; the key of keyID is left to be
+// cached by the caller of Load.
+//
+// Failing to cache the other keys is ignored, since each is loaded again when
+// it is needed.
+func Pick[K any](ctx context.Context, cache oauth.Cache[string, K], keys map[string]K, keyID string, ttl time.Duration) (K, bool) {
+	for kid, key := range keys {
+		if kid != keyID {
+			_ = oauth.Put(ctx, cache, kid, key, ttl)
+		}
+	}
+	key, found := keys[keyID]
+	return key, found
+}
+
+// missing records keyID as missing from the document
+func (f *Fetcher) missing(keyID string) {
+	if f.negative > 0 {
+		f.unknown.Put(keyID, true, f.negative)
+	}
+}
+
+// attempted returns whether the document was fetched within the refetch
+// interval, along with the error of that fetch, if any
+func (f *Fetcher) attempted() (bool, error) {
+	now := f.clock()
+
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if f.fetched.IsZero() || now.Sub(f.fetched) >= f.interval {
+		return false, nil
+	}
+	return true, f.err
+}
+
+// usable returns the most recent document and how long its keys may be
+// cached, unless the document expired longer ago than the grace period
+func (f *Fetcher) usable() ([]byte, time.Duration) {
+	now := f.clock()
+
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	remaining := f.expires.Sub(now)
+	switch {
+	case f.body == nil:
+		return nil, 0
+	case remaining > 0:
+		return f.body, min(max(remaining, f.minTTL), f.maxTTL)
+	case remaining+f.grace > 0:
+		// stale; keys are cached briefly such that the fetch is retried
+		return f.body, min(f.minTTL, remaining+f.grace)
+	default:
+		return nil, 0
+	}
+}
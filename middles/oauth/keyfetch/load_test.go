@@ -0,0 +1,286 @@
+package keyfetch
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"cattlecloud.net/go/webtools/middles/oauth"
+	"github.com/shoenig/test/must"
+)
+
+// parseKids finds keyID among a JSON list of kids
+func parseKids(_ context.Context, body []byte, keyID string, _ time.Duration) (string, bool, error) {
+	var kids []string
+	if err := json.Unmarshal(body, &kids); err != nil {
+		return "", false, err
+	}
+	return keyID, slices.Contains(kids, keyID), nil
+}
+
+func TestLoad(t *testing.T) {
+	t.Parallel()
+
+	var requests atomic.Int32
+	kids := []string{"kid-1", "kid-2"}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		requests.Add(1)
+		_ = json.NewEncoder(w).Encode(kids)
+	}))
+	t.Cleanup(ts.Close)
+
+	now := time.Now()
+	f := New(ts.URL, SetHTTP(ts.Client()))
+	f.clock = func() time.Time { return now }
+	ctx := context.Background()
+
+	key, ttl, err := Load(ctx, f, "kid-1", parseKids)
+	must.NoError(t, err)
+	must.Eq(t, "kid-1", key)
+	must.Eq(t, 1*time.Hour, ttl)
+	must.Eq(t, 1, requests.Load())
+
+	// a known key is found in the recent document without fetching again
+	key, _, err = Load(ctx, f, "kid-2", parseKids)
+	must.NoError(t, err)
+	must.Eq(t, "kid-2", key)
+	must.Eq(t, 1, requests.Load())
+
+	// an unknown key is rejected without fetching again
+	_, _, err = Load(ctx, f, "kid-3", parseKids)
+	var rejected *RejectedError
+	must.True(t, errors.As(err, &rejected))
+	must.Eq(t, "kid-3", rejected.KeyID)
+	must.ErrorIs(t, err, ErrKeyNotFound)
+	must.Eq(t, 1, requests.Load())
+
+	// once the interval passes, another unknown key causes a fetch
+	now = now.Add(1 * time.Minute)
+	_, _, err = Load(ctx, f, "kid-4", parseKids)
+	must.ErrorIs(t, err, ErrKeyNotFound)
+	must.False(t, errors.As(err, &rejected))
+	must.Eq(t, 2, requests.Load())
+
+	// but not a key which was recently found missing
+	now = now.Add(1 * time.Minute)
+	_, _, err = Load(ctx, f, "kid-4", parseKids)
+	must.True(t, errors.As(err, &rejected))
+	must.Eq(t, 2, requests.Load())
+
+	// a newly published key is found by the next fetch
+	kids = append(kids, "kid-5")
+	key, _, err = Load(ctx, f, "kid-5", parseKids)
+	must.NoError(t, err)
+	must.Eq(t, "kid-5", key)
+	must.Eq(t, 3, requests.Load())
+}
+
+func TestLoad_rotated(t *testing.T) {
+	t.Parallel()
+
+	var requests atomic.Int32
+	var kids atomic.Value
+	kids.Store(`["kid-1"]`)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		requests.Add(1)
+		_, _ = w.Write([]byte(kids.Load().(string)))
+	}))
+	t.Cleanup(ts.Close)
+
+	now := time.Now()
+	f := New(ts.URL, SetHTTP(ts.Client()))
+	f.clock = func() time.Time { return now }
+	ctx := context.Background()
+
+	_, _, err := Load(ctx, f, "kid-1", parseKids)
+	must.NoError(t, err)
+
+	// the provider publishes a new key, which is first seen within the
+	// refetch interval
+	kids.Store(`["kid-1","kid-2"]`)
+	now = now.Add(10 * time.Second)
+	_, _, err = Load(ctx, f, "kid-2", parseKids)
+	var rejected *RejectedError
+	must.True(t, errors.As(err, &rejected))
+	must.Eq(t, 1, requests.Load())
+
+	// the key is found once the interval passes
+	now = now.Add(1 * time.Minute)
+	key, _, err := Load(ctx, f, "kid-2", parseKids)
+	must.NoError(t, err)
+	must.Eq(t, "kid-2", key)
+	must.Eq(t, 2, requests.Load())
+
+	// a key missing from a fetched document is rejected for the negative ttl
+	now = now.Add(1 * time.Minute)
+	_, _, err = Load(ctx, f, "kid-3", parseKids)
+	must.ErrorIs(t, err, ErrKeyNotFound)
+	must.Eq(t, 3, requests.Load())
+
+	now = now.Add(4 * time.Minute)
+	_, _, err = Load(ctx, f, "kid-3", parseKids)
+	must.True(t, errors.As(err, &rejected))
+	must.Eq(t, 3, requests.Load())
+
+	// until the negative ttl passes
+	now = now.Add(2 * time.Minute)
+	_, _, err = Load(ctx, f, "kid-3", parseKids)
+	must.False(t, errors.As(err, &rejected))
+	must.Eq(t, 4, requests.Load())
+}
+
+func TestLoad_noStore(t *testing.T) {
+	t.Parallel()
+
+	var requests atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		requests.Add(1)
+		w.Header().Set("Cache-Control", "no-store")
+		_, _ = w.Write([]byte(`["kid-1","kid-2"]`))
+	}))
+	t.Cleanup(ts.Close)
+
+	f := New(ts.URL, SetHTTP(ts.Client()))
+	ctx := context.Background()
+
+	_, _, err := Load(ctx, f, "kid-1", parseKids)
+	must.NoError(t, err)
+
+	// the document was not retained, so there is nothing to look in
+	_, _, err = Load(ctx, f, "kid-2", parseKids)
+	var rejected *RejectedError
+	must.True(t, errors.As(err, &rejected))
+	must.Eq(t, 1, requests.Load())
+}
+
+func TestLoad_noInterval(t *testing.T) {
+	t.Parallel()
+
+	var requests atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		requests.Add(1)
+		_, _ = w.Write([]byte(`["kid-1"]`))
+	}))
+	t.Cleanup(ts.Close)
+
+	f := New(ts.URL, SetHTTP(ts.Client()), SetRefetchInterval(0), SetNegativeTTL(0))
+	ctx := context.Background()
+
+	for range 3 {
+		_, _, err := Load(ctx, f, "kid-2", parseKids)
+		must.ErrorIs(t, err, ErrKeyNotFound)
+	}
+	must.Eq(t, 3, requests.Load())
+}
+
+func TestLoad_stale(t *testing.T) {
+	t.Parallel()
+
+	var down atomic.Bool
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		if down.Load() {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Header().Set("Cache-Control", "max-age=3600")
+		_, _ = w.Write([]byte(`["kid-1","kid-2"]`))
+	}))
+	t.Cleanup(ts.Close)
+
+	start := time.Now()
+	now := start
+	f := New(ts.URL, SetHTTP(ts.Client()), SetStaleGrace(2*time.Hour))
+	f.clock = func() time.Time { return now }
+	ctx := context.Background()
+
+	_, _, err := Load(ctx, f, "kid-1", parseKids)
+	must.NoError(t, err)
+	must.False(t, f.Health().Stale())
+
+	// the provider goes down after the document expires
+	down.Store(true)
+	now = start.Add(90 * time.Minute)
+
+	key, ttl, err := Load(ctx, f, "kid-1", parseKids)
+	must.NoError(t, err)
+	must.Eq(t, "kid-1", key)
+	must.Eq(t, 1*time.Minute, ttl)
+
+	health := f.Health()
+	must.True(t, health.Stale())
+	must.Eq(t, 30*time.Minute, health.Staleness)
+	must.Eq(t, start, health.Updated)
+	must.ErrorContains(t, health.Err, "unexpected status 502")
+
+	// within the refetch interval the stale document is still used
+	key, _, err = Load(ctx, f, "kid-2", parseKids)
+	must.NoError(t, err)
+	must.Eq(t, "kid-2", key)
+
+	// but an unknown key cannot be found out
+	_, _, err = Load(ctx, f, "kid-3", parseKids)
+	must.ErrorContains(t, err, "unexpected status 502")
+	now = now.Add(1 * time.Minute)
+	_, _, err = Load(ctx, f, "kid-3", parseKids)
+	must.ErrorContains(t, err, "unexpected status 502")
+
+	// once past the grace period the document is no longer used
+	now = start.Add(3*time.Hour + 1*time.Second)
+	_, _, err = Load(ctx, f, "kid-1", parseKids)
+	must.ErrorContains(t, err, "unexpected status 502")
+
+	// and the document is fresh again once the provider recovers
+	down.Store(false)
+	now = now.Add(1 * time.Minute)
+	_, _, err = Load(ctx, f, "kid-1", parseKids)
+	must.NoError(t, err)
+
+	health = f.Health()
+	must.False(t, health.Stale())
+	must.NoError(t, health.Err)
+	must.Eq(t, now, health.Updated)
+}
+
+// downCache is a cache which cannot store anything
+type downCache struct {
+	*oauth.VolatileCache[string]
+}
+
+func (downCache) PutContext(context.Context, string, string, time.Duration) error {
+	return errors.New("cache is down")
+}
+
+func (downCache) GetContext(context.Context, string) (string, bool, error) {
+	return "", false, errors.New("cache is down")
+}
+
+func TestPick(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	keys := map[string]string{"kid-1": "one", "kid-2": "two", "kid-3": "three"}
+
+	cache := oauth.NewVolatileCache[string](10)
+	key, found := Pick(ctx, cache, keys, "kid-2", time.Minute)
+	must.True(t, found)
+	must.Eq(t, "two", key)
+
+	// the other keys are cached, the wanted key is left to the caller
+	must.Eq(t, 2, cache.Len())
+	_, exists := cache.Get("kid-2")
+	must.False(t, exists)
+
+	_, found = Pick(ctx, cache, keys, "kid-4", time.Minute)
+	must.False(t, found)
+
+	// failing to cache the other keys does not fail finding the wanted key
+	key, found = Pick(ctx, downCache{oauth.NewVolatileCache[string](10)}, keys, "kid-1", time.Minute)
+	must.True(t, found)
+	must.Eq(t, "one", key)
+}
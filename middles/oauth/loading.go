@@ -0,0 +1,51 @@
+package oauth
+
+import (
+	"context"
+	"time"
+)
+
+// Loader is used to load the value of a key missing from a Cache, returning
+// the value and how long the value should be cached.
+type Loader[T any] func(context.Context) (T, time.Duration, error)
+
+// NewLoadingCache creates a LoadingCache backed by cache.
+func NewLoadingCache[T any](cache Cache[string, T]) *LoadingCache[T] {
+	return &LoadingCache[T]{Cache: cache}
+}
+
+// LoadingCache is a Cache which can load missing values, such that concurrent
+// loads of the same key are coalesced into one call of the Loader.
+type LoadingCache[T any] struct {
+	Cache[string, T]
+	flight flight[T]
+}
+
+// GetOrLoad returns the value of key from the cache, or if missing, the value
+// returned by loader, which is then stored in the cache for the duration also
+// returned by loader.
+//
+// If loads for key are already in flight, GetOrLoad waits for and returns the
+// result of that load instead of calling loader. The load is not cancelled
+// along with ctx, such that callers waiting on the same load are not failed;
+// ctx bounds only how long GetOrLoad waits.
+//
+// A failure of the cache does not fail GetOrLoad; a value which cannot be read
+// from the cache is loaded, and a loaded value which cannot be stored is still
+// returned.
+func (lc *LoadingCache[T]) GetOrLoad(ctx context.Context, key string, loader Loader[T]) (T, error) {
+	if value, exists, err := Get(ctx, lc.Cache, key); err == nil && exists {
+		return value, nil
+	}
+
+	value, _, err := lc.flight.do(ctx, key, func(ctx context.Context) (T, bool, error) {
+		loaded, ttl, lerr := loader(ctx)
+		if lerr != nil {
+			return loaded, false, lerr
+		}
+		_ = Put(ctx, lc.Cache, key, loaded, ttl)
+		return loaded, true, nil
+	})
+
+	return value, err
+}
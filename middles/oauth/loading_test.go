@@ -0,0 +1,104 @@
+package oauth
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/shoenig/test/must"
+)
+
+var _ Cache[string, int] = (*LoadingCache[int])(nil)
+
+func TestLoadingCache_GetOrLoad(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	t.Run("hit", func(t *testing.T) {
+		lc := NewLoadingCache[int](NewVolatileCache[int](size))
+		lc.Put("a", 1, 1*time.Minute)
+
+		value, err := lc.GetOrLoad(ctx, "a", func(context.Context) (int, time.Duration, error) {
+			return 0, 0, errors.New("should not be called")
+		})
+		must.NoError(t, err)
+		must.Eq(t, 1, value)
+	})
+
+	t.Run("miss", func(t *testing.T) {
+		now := time.Now()
+		vc := NewVolatileCache[int](size)
+		vc.clock = func() time.Time { return now }
+		lc := NewLoadingCache[int](vc)
+
+		value, err := lc.GetOrLoad(ctx, "a", func(context.Context) (int, time.Duration, error) {
+			return 2, 1 * time.Minute, nil
+		})
+		must.NoError(t, err)
+		must.Eq(t, 2, value)
+
+		// stored with the ttl given by the loader
+		_, exists := lc.Get("a")
+		must.True(t, exists)
+		now = now.Add(2 * time.Minute)
+		_, exists = lc.Get("a")
+		must.False(t, exists)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		lc := NewLoadingCache[int](NewVolatileCache[int](size))
+
+		_, err := lc.GetOrLoad(ctx, "a", func(context.Context) (int, time.Duration, error) {
+			return 0, 0, errBackend
+		})
+		must.ErrorIs(t, err, errBackend)
+
+		_, exists := lc.Get("a")
+		must.False(t, exists)
+	})
+
+	t.Run("cache down", func(t *testing.T) {
+		lc := NewLoadingCache[string](new(failingCache))
+
+		// the cache cannot be read or written, but the value is still loaded
+		value, err := lc.GetOrLoad(ctx, "a", func(context.Context) (string, time.Duration, error) {
+			return "b", 1 * time.Minute, nil
+		})
+		must.NoError(t, err)
+		must.Eq(t, "b", value)
+	})
+
+	t.Run("coalesce", func(t *testing.T) {
+		lc := NewLoadingCache[int](NewVolatileCache[int](size))
+
+		var calls atomic.Int64
+		release := make(chan struct{})
+		loader := func(context.Context) (int, time.Duration, error) {
+			calls.Add(1)
+			<-release
+			return 3, 1 * time.Minute, nil
+		}
+
+		var wg sync.WaitGroup
+		for range 100 {
+			wg.Go(func() {
+				value, err := lc.GetOrLoad(ctx, "a", loader)
+				must.NoError(t, err)
+				must.Eq(t, 3, value)
+			})
+		}
+
+		for calls.Load() == 0 {
+			time.Sleep(1 * time.Millisecond)
+		}
+		time.Sleep(10 * time.Millisecond) // let the others pile up
+		close(release)
+		wg.Wait()
+
+		must.Eq(t, 1, calls.Load())
+	})
+}
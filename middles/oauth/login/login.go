@@ -0,0 +1,298 @@
+// Package login provides http.Handler implementations of the OAuth 2.0
+// authorization code flow with OpenID Connect, for any provider.
+package login
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"cattlecloud.net/go/webtools/middles"
+	"cattlecloud.net/go/webtools/middles/identity"
+	"cattlecloud.net/go/webtools/middles/oauth/nonces"
+	"github.com/shoenig/go-conceal"
+)
+
+var (
+	// ErrDenied indicates the provider responded to the authorization request
+	// with an error, e.g. because the user declined to log in.
+	ErrDenied = errors.New("login: authorization denied")
+
+	// ErrProviderNotValid indicates the login was started for a different
+	// provider than that of the callback.
+	ErrProviderNotValid = errors.New("login: provider not valid")
+
+	// ErrExchange indicates the authorization code could not be exchanged for
+	// tokens.
+	ErrExchange = errors.New("login: unable to exchange code")
+
+	// ErrNonceNotValid indicates the nonce claim of the id_token does not match
+	// the nonce of the login.
+	ErrNonceNotValid = errors.New("login: nonce not valid")
+
+	// ErrSession indicates a session could not be created.
+	ErrSession = errors.New("login: unable to create session")
+)
+
+// Provider describes the endpoints of an OAuth provider, and the credentials
+// of the client registered with the provider.
+type Provider struct {
+	// Name of the provider, carried through the login by the state parameter.
+	Name string
+
+	// AuthorizeURL is the authorization endpoint of the provider, e.g.
+	// https://accounts.google.com/o/oauth2/v2/auth
+	AuthorizeURL string
+
+	// TokenURL is the token endpoint of the provider, e.g.
+	// https://oauth2.googleapis.com/token
+	TokenURL string
+
+	ClientID     string
+	ClientSecret *conceal.Text
+	RedirectURL  string
+
+	// Scopes requested of the provider; the default is openid and email.
+	Scopes []string
+
+	// ResponseMode of the callback, e.g. form_post as required by Apple when
+	// requesting the email scope. The default is a query string.
+	ResponseMode string
+}
+
+func (p *Provider) scopes() string {
+	if len(p.Scopes) == 0 {
+		return "openid email"
+	}
+	return strings.Join(p.Scopes, " ")
+}
+
+// Claims are the claims of a validated id_token.
+type Claims interface {
+	GetNonce() string
+}
+
+// Validator validates an id_token, e.g. the Validator of the googlekeys,
+// microsoftkeys, or applekeys packages.
+type Validator[C Claims] interface {
+	Validate(string) (C, error)
+}
+
+// Start is an http.Handler which begins a login, redirecting the user to the
+// authorization endpoint of the Provider. The local path to return to once
+// logged in is taken from the "return" query parameter, if set.
+type Start struct {
+	Provider *Provider
+	States   *nonces.States
+}
+
+func (s *Start) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	login, err := s.States.Begin(w, s.Provider.Name, r.URL.Query().Get("return"))
+	if err != nil {
+		http.Error(w, "unable to start login", http.StatusBadRequest)
+		return
+	}
+
+	params := map[string]string{
+		"response_type": "code",
+		"client_id":     s.Provider.ClientID,
+		"redirect_uri":  s.Provider.RedirectURL,
+		"scope":         s.Provider.scopes(),
+		"state":         login.State,
+		"nonce":         login.Nonce.Unveil(),
+	}
+
+	if login.Challenge != "" {
+		params["code_challenge"] = login.Challenge
+		params["code_challenge_method"] = nonces.ChallengeMethod
+	}
+
+	if s.Provider.ResponseMode != "" {
+		params["response_mode"] = s.Provider.ResponseMode
+	}
+
+	// the authorize url is configuration and known to be valid; any query it
+	// already has (e.g. the policy of azure b2c) is kept
+	endpoint, _ := url.Parse(s.Provider.AuthorizeURL)
+	query := endpoint.Query()
+	for key, value := range params {
+		query.Set(key, value)
+	}
+	endpoint.RawQuery = query.Encode()
+
+	http.Redirect(w, r, endpoint.String(), http.StatusFound)
+}
+
+// Callback is an http.Handler which completes a login at the redirect url of
+// the Provider. The authorization code is exchanged for an id_token, which is
+// validated, and the claims of which are mapped to a user identity. A session
+// is created for the user, who is then redirected to the return path of the
+// login.
+type Callback[C Claims, I identity.UserIdentity] struct {
+	Provider  *Provider
+	States    *nonces.States
+	Validator Validator[C]
+	Sessions  middles.Sessions[I]
+
+	// Identify maps the claims of a user to their identity, e.g. by looking up
+	// or creating the user in a database.
+	Identify func(context.Context, C) (I, error)
+
+	// TTL of the session created for the user; the default is 30 days.
+	TTL time.Duration
+
+	// Client used for exchanging the authorization code; the default client
+	// has a timeout of one minute.
+	Client *http.Client
+
+	// Reject is called when the login fails. If not set, a plain 401
+	// Unauthorized response is written.
+	Reject func(http.ResponseWriter, *http.Request, error)
+}
+
+func (c *Callback[C, I]) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	returnURL, err := c.login(w, r)
+	if err != nil {
+		c.reject(w, r, err)
+		return
+	}
+
+	if returnURL == "" {
+		returnURL = "/"
+	}
+
+	http.Redirect(w, r, returnURL, http.StatusFound)
+}
+
+// login completes the login of r, setting the session cookie on w and
+// returning the local path to redirect to
+func (c *Callback[C, I]) login(w http.ResponseWriter, r *http.Request) (string, error) {
+	ctx := r.Context()
+
+	if e := r.FormValue("error"); e != "" {
+		return "", fmt.Errorf("%w: %s", ErrDenied, e)
+	}
+
+	login, err := c.States.Complete(w, r)
+	if err != nil {
+		return "", err
+	}
+
+	if login.Provider != c.Provider.Name {
+		return "", ErrProviderNotValid
+	}
+
+	idToken, err := c.exchange(ctx, r.FormValue("code"), login.Verifier)
+	if err != nil {
+		return "", err
+	}
+
+	claims, err := c.Validator.Validate(idToken)
+	if err != nil {
+		return "", err
+	}
+
+	if subtle.ConstantTimeCompare([]byte(claims.GetNonce()), []byte(login.Nonce.Unveil())) != 1 {
+		return "", ErrNonceNotValid
+	}
+
+	id, err := c.Identify(ctx, claims)
+	if err != nil {
+		return "", err
+	}
+
+	cookie := c.Sessions.Create(id, c.ttl())
+	if cookie == nil {
+		return "", ErrSession
+	}
+	http.SetCookie(w, cookie)
+
+	return login.ReturnURL, nil
+}
+
+// tokens is the response of the token endpoint
+type tokens struct {
+	IDToken          string `json:"id_token"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// exchange the authorization code for tokens, returning the id_token
+func (c *Callback[C, I]) exchange(ctx context.Context, code string, verifier *conceal.Text) (string, error) {
+	if code == "" {
+		return "", fmt.Errorf("%w: missing code", ErrExchange)
+	}
+
+	form := url.Values{
+		"grant_type":   {"authorization_code"},
+		"code":         {code},
+		"redirect_uri": {c.Provider.RedirectURL},
+		"client_id":    {c.Provider.ClientID},
+	}
+
+	if c.Provider.ClientSecret != nil {
+		form.Set("client_secret", c.Provider.ClientSecret.Unveil())
+	}
+
+	if verifier != nil {
+		form.Set("code_verifier", verifier.Unveil())
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, c.Provider.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", ErrExchange, err)
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Accept", "application/json")
+
+	response, err := c.client().Do(request)
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", ErrExchange, err)
+	}
+	defer func() { _ = response.Body.Close() }()
+
+	var t tokens
+	if err = json.NewDecoder(io.LimitReader(response.Body, 1<<20)).Decode(&t); err != nil {
+		return "", fmt.Errorf("%w: %w", ErrExchange, err)
+	}
+
+	switch {
+	case t.Error != "":
+		return "", fmt.Errorf("%w: %s %s", ErrExchange, t.Error, t.ErrorDescription)
+	case response.StatusCode != http.StatusOK:
+		return "", fmt.Errorf("%w: unexpected status %d", ErrExchange, response.StatusCode)
+	case t.IDToken == "":
+		return "", fmt.Errorf("%w: missing id_token", ErrExchange)
+	}
+
+	return t.IDToken, nil
+}
+
+func (c *Callback[C, I]) reject(w http.ResponseWriter, r *http.Request, err error) {
+	if c.Reject != nil {
+		c.Reject(w, r, err)
+		return
+	}
+	http.Error(w, "login failed", http.StatusUnauthorized)
+}
+
+func (c *Callback[C, I]) ttl() time.Duration {
+	if c.TTL <= 0 {
+		return 30 * 24 * time.Hour
+	}
+	return c.TTL
+}
+
+func (c *Callback[C, I]) client() *http.Client {
+	if c.Client == nil {
+		return &http.Client{Timeout: 1 * time.Minute}
+	}
+	return c.Client
+}
@@ -0,0 +1,287 @@
+package login
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"cattlecloud.net/go/webtools/middles/oauth"
+	"cattlecloud.net/go/webtools/middles/oauth/applekeys"
+	"cattlecloud.net/go/webtools/middles/oauth/googlekeys"
+	"cattlecloud.net/go/webtools/middles/oauth/microsoftkeys"
+	"cattlecloud.net/go/webtools/middles/oauth/nonces"
+	"cattlecloud.net/go/webtools/middles/oauth/oidc"
+	"github.com/shoenig/go-conceal"
+	"github.com/shoenig/test/must"
+)
+
+var (
+	_ Validator[*applekeys.Claims]     = applekeys.New()
+	_ Validator[*googlekeys.Claims]    = googlekeys.New()
+	_ Validator[*microsoftkeys.Claims] = microsoftkeys.New()
+	_ Validator[*oidc.Claims]          = oidc.New()
+)
+
+type testClaims struct {
+	nonce string
+	email string
+}
+
+func (tc *testClaims) GetNonce() string { return tc.nonce }
+
+// testValidator decodes id tokens which are plain json
+type testValidator struct{}
+
+func (testValidator) Validate(token string) (*testClaims, error) {
+	var m map[string]string
+	if err := json.Unmarshal([]byte(token), &m); err != nil {
+		return nil, err
+	}
+	return &testClaims{nonce: m["nonce"], email: m["email"]}, nil
+}
+
+// testSessions creates a session cookie for any user
+type testSessions struct{}
+
+func (testSessions) Create(id int, _ time.Duration) *http.Cookie {
+	return &http.Cookie{Name: "session", Value: "user-" + strconv.Itoa(id)}
+}
+
+func (testSessions) Match(int, *conceal.Text) error { return nil }
+
+// provider is a fake token endpoint, which issues an id_token containing the
+// nonce of each code
+type provider struct {
+	t      *testing.T
+	server *httptest.Server
+	nonces map[string]string // code -> nonce
+	forms  []url.Values
+}
+
+func newProvider(t *testing.T) *provider {
+	p := &provider{t: t, nonces: make(map[string]string)}
+	p.server = httptest.NewServer(http.HandlerFunc(p.token))
+	t.Cleanup(p.server.Close)
+	return p
+}
+
+func (p *provider) token(w http.ResponseWriter, r *http.Request) {
+	must.NoError(p.t, r.ParseForm())
+	p.forms = append(p.forms, r.PostForm)
+
+	nonce, exists := p.nonces[r.PostForm.Get("code")]
+	if !exists {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	b, _ := json.Marshal(map[string]string{"nonce": nonce, "email": "tester@example.com"})
+	_ = json.NewEncoder(w).Encode(map[string]string{"id_token": string(b)})
+}
+
+type setup struct {
+	provider *provider
+	start    *Start
+	callback *Callback[*testClaims, int]
+	errs     []error
+}
+
+func newSetup(t *testing.T) *setup {
+	p := newProvider(t)
+
+	config := &Provider{
+		Name:         "test",
+		AuthorizeURL: "https://auth.example.com/authorize",
+		TokenURL:     p.server.URL + "/token",
+		ClientID:     "client-1",
+		ClientSecret: conceal.New("secret"),
+		RedirectURL:  "https://site.example.com/callback",
+	}
+
+	states := &nonces.States{
+		Mint:      nonces.New(),
+		Verifiers: oauth.NewVolatileCache[string](10),
+	}
+
+	s := &setup{provider: p}
+	s.start = &Start{Provider: config, States: states}
+	s.callback = &Callback[*testClaims, int]{
+		Provider:  config,
+		States:    states,
+		Validator: testValidator{},
+		Sessions:  testSessions{},
+		Identify: func(_ context.Context, c *testClaims) (int, error) {
+			if c.email != "tester@example.com" {
+				return 0, errors.New("unknown user")
+			}
+			return 7, nil
+		},
+		Client: p.server.Client(),
+		Reject: func(w http.ResponseWriter, _ *http.Request, err error) {
+			s.errs = append(s.errs, err)
+			w.WriteHeader(http.StatusUnauthorized)
+		},
+	}
+	return s
+}
+
+// begin a login, returning the authorize url and state cookie
+func (s *setup) begin(t *testing.T, returnURL string) (*url.URL, *http.Cookie) {
+	t.Helper()
+
+	w := httptest.NewRecorder()
+	s.start.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/login?return="+url.QueryEscape(returnURL), nil))
+	must.Eq(t, http.StatusFound, w.Code)
+
+	u, err := url.Parse(w.Header().Get("Location"))
+	must.NoError(t, err)
+
+	cookies := w.Result().Cookies()
+	must.SliceLen(t, 1, cookies)
+	return u, cookies[0]
+}
+
+// complete a login, as redirected back by the provider
+func (s *setup) complete(state, code string, cookie *http.Cookie) *httptest.ResponseRecorder {
+	query := url.Values{"state": {state}, "code": {code}}
+	r := httptest.NewRequest(http.MethodGet, "/callback?"+query.Encode(), nil)
+	r.AddCookie(cookie)
+	w := httptest.NewRecorder()
+	s.callback.ServeHTTP(w, r)
+	return w
+}
+
+func TestStart(t *testing.T) {
+	t.Parallel()
+
+	s := newSetup(t)
+	u, cookie := s.begin(t, "/account")
+
+	must.Eq(t, "auth.example.com", u.Host)
+	must.Eq(t, "/authorize", u.Path)
+
+	q := u.Query()
+	must.Eq(t, "code", q.Get("response_type"))
+	must.Eq(t, "client-1", q.Get("client_id"))
+	must.Eq(t, "https://site.example.com/callback", q.Get("redirect_uri"))
+	must.Eq(t, "openid email", q.Get("scope"))
+	must.Eq(t, cookie.Value, q.Get("state"))
+	must.UUIDv4(t, q.Get("nonce"))
+	must.Eq(t, "S256", q.Get("code_challenge_method"))
+	must.NotEq(t, "", q.Get("code_challenge"))
+	must.Eq(t, "", q.Get("response_mode"))
+
+	t.Run("bad return", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		s.start.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/login?return=https://evil.example.com", nil))
+		must.Eq(t, http.StatusBadRequest, w.Code)
+	})
+}
+
+func TestStart_authorizeQuery(t *testing.T) {
+	t.Parallel()
+
+	// e.g. azure b2c, where the policy is part of the authorize url
+	s := newSetup(t)
+	s.start.Provider.AuthorizeURL = "https://tenant.b2clogin.com/tenant.onmicrosoft.com/oauth2/v2.0/authorize?p=b2c_1_signin"
+	u, cookie := s.begin(t, "/account")
+
+	must.Eq(t, "/tenant.onmicrosoft.com/oauth2/v2.0/authorize", u.Path)
+	q := u.Query()
+	must.Eq(t, "b2c_1_signin", q.Get("p"))
+	must.Eq(t, "client-1", q.Get("client_id"))
+	must.Eq(t, cookie.Value, q.Get("state"))
+}
+
+func TestCallback(t *testing.T) {
+	t.Parallel()
+
+	s := newSetup(t)
+	u, cookie := s.begin(t, "/account")
+	s.provider.nonces["code-1"] = u.Query().Get("nonce")
+
+	w := s.complete(u.Query().Get("state"), "code-1", cookie)
+	must.Eq(t, http.StatusFound, w.Code)
+	must.Eq(t, "/account", w.Header().Get("Location"))
+	must.SliceEmpty(t, s.errs)
+
+	// the session cookie is set, and the state cookie cleared
+	cookies := w.Result().Cookies()
+	must.SliceLen(t, 2, cookies)
+	must.Eq(t, nonces.DefaultStateCookieName, cookies[0].Name)
+	must.Eq(t, "session", cookies[1].Name)
+	must.Eq(t, "user-7", cookies[1].Value)
+
+	// the code was exchanged along with the pkce verifier
+	must.SliceLen(t, 1, s.provider.forms)
+	form := s.provider.forms[0]
+	must.Eq(t, "authorization_code", form.Get("grant_type"))
+	must.Eq(t, "code-1", form.Get("code"))
+	must.Eq(t, "client-1", form.Get("client_id"))
+	must.Eq(t, "secret", form.Get("client_secret"))
+	must.Eq(t, 43, len(form.Get("code_verifier")))
+}
+
+func TestCallback_failures(t *testing.T) {
+	t.Parallel()
+
+	t.Run("denied", func(t *testing.T) {
+		s := newSetup(t)
+		r := httptest.NewRequest(http.MethodGet, "/callback?error=access_denied", nil)
+		w := httptest.NewRecorder()
+		s.callback.ServeHTTP(w, r)
+		must.Eq(t, http.StatusUnauthorized, w.Code)
+		must.ErrorIs(t, s.errs[0], ErrDenied)
+	})
+
+	t.Run("state", func(t *testing.T) {
+		s := newSetup(t)
+		u, _ := s.begin(t, "")
+		_, other := s.begin(t, "")
+		s.complete(u.Query().Get("state"), "code-1", other)
+		must.ErrorIs(t, s.errs[0], nonces.ErrStateNotValid)
+	})
+
+	t.Run("provider", func(t *testing.T) {
+		s := newSetup(t)
+		u, cookie := s.begin(t, "")
+		s.callback.Provider = &Provider{Name: "other"}
+		s.complete(u.Query().Get("state"), "code-1", cookie)
+		must.ErrorIs(t, s.errs[0], ErrProviderNotValid)
+	})
+
+	t.Run("exchange", func(t *testing.T) {
+		s := newSetup(t)
+		u, cookie := s.begin(t, "")
+		s.complete(u.Query().Get("state"), "unknown-code", cookie)
+		must.ErrorIs(t, s.errs[0], ErrExchange)
+		must.ErrorContains(t, s.errs[0], "invalid_grant")
+	})
+
+	t.Run("nonce", func(t *testing.T) {
+		s := newSetup(t)
+		u, cookie := s.begin(t, "")
+		s.provider.nonces["code-1"] = "some other nonce"
+		s.complete(u.Query().Get("state"), "code-1", cookie)
+		must.ErrorIs(t, s.errs[0], ErrNonceNotValid)
+	})
+
+	t.Run("identify", func(t *testing.T) {
+		s := newSetup(t)
+		u, cookie := s.begin(t, "")
+		s.provider.nonces["code-1"] = u.Query().Get("nonce")
+		s.callback.Identify = func(context.Context, *testClaims) (int, error) {
+			return 0, errors.New("unknown user")
+		}
+		w := s.complete(u.Query().Get("state"), "code-1", cookie)
+		must.Eq(t, http.StatusUnauthorized, w.Code)
+		must.ErrorContains(t, s.errs[0], "unknown user")
+	})
+}
@@ -0,0 +1,205 @@
+package memcache
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+// conn is a connection to one memcached server
+type conn struct {
+	nc net.Conn
+	r  *bufio.Reader
+	w  *bufio.Writer
+}
+
+func newConn(nc net.Conn) *conn {
+	return &conn{
+		nc: nc,
+		r:  bufio.NewReader(nc),
+		w:  bufio.NewWriter(nc),
+	}
+}
+
+func (c *conn) deadline(ctx context.Context, timeout time.Duration) error {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(timeout)
+	}
+	return c.nc.SetDeadline(deadline)
+}
+
+// get implements the get command, returning the data of key if it exists
+func (c *conn) get(key string) ([]byte, bool, error) {
+	if _, err := fmt.Fprintf(c.w, "get %s\r\n", key); err != nil {
+		return nil, false, err
+	}
+	if err := c.w.Flush(); err != nil {
+		return nil, false, err
+	}
+
+	line, err := c.line()
+	if err != nil {
+		return nil, false, err
+	}
+
+	if bytes.Equal(line, []byte("END")) {
+		return nil, false, nil
+	}
+
+	// VALUE <key> <flags> <bytes>
+	fields := bytes.Fields(line)
+	if len(fields) != 4 || !bytes.Equal(fields[0], []byte("VALUE")) {
+		return nil, false, replyError(line)
+	}
+
+	size, err := strconv.Atoi(string(fields[3]))
+	if err != nil {
+		return nil, false, fmt.Errorf("memcache: malformed reply: %w", err)
+	}
+
+	data := make([]byte, size+2)
+	if _, err = io.ReadFull(c.r, data); err != nil {
+		return nil, false, err
+	}
+
+	end, err := c.line()
+	if err != nil {
+		return nil, false, err
+	}
+	if !bytes.Equal(end, []byte("END")) {
+		return nil, false, unexpected(end)
+	}
+
+	return data[:size], true, nil
+}
+
+// set implements the set command
+func (c *conn) set(key string, data []byte, exptime int64) error {
+	if err := c.store("set", key, data, exptime); err != nil {
+		return err
+	}
+	return c.expect("STORED")
+}
+
+// add implements the add command, returning whether key was stored, which it
+// is only if key did not exist
+func (c *conn) add(key string, data []byte, exptime int64) (bool, error) {
+	if err := c.store("add", key, data, exptime); err != nil {
+		return false, err
+	}
+	if err := c.w.Flush(); err != nil {
+		return false, err
+	}
+
+	line, err := c.line()
+	switch {
+	case err != nil:
+		return false, err
+	case bytes.Equal(line, []byte("STORED")):
+		return true, nil
+	case bytes.Equal(line, []byte("NOT_STORED")):
+		return false, nil
+	default:
+		return false, replyError(line)
+	}
+}
+
+// store writes a storage command of data
+func (c *conn) store(command, key string, data []byte, exptime int64) error {
+	if _, err := fmt.Fprintf(c.w, "%s %s 0 %d %d\r\n", command, key, exptime, len(data)); err != nil {
+		return err
+	}
+	if _, err := c.w.Write(data); err != nil {
+		return err
+	}
+	_, err := c.w.WriteString("\r\n")
+	return err
+}
+
+// delete implements the delete command, returning whether key existed
+func (c *conn) delete(key string) (bool, error) {
+	if _, err := fmt.Fprintf(c.w, "delete %s\r\n", key); err != nil {
+		return false, err
+	}
+	if err := c.w.Flush(); err != nil {
+		return false, err
+	}
+
+	line, err := c.line()
+	switch {
+	case err != nil:
+		return false, err
+	case bytes.Equal(line, []byte("DELETED")):
+		return true, nil
+	case bytes.Equal(line, []byte("NOT_FOUND")):
+		return false, nil
+	default:
+		return false, replyError(line)
+	}
+}
+
+func (c *conn) expect(reply string) error {
+	if err := c.w.Flush(); err != nil {
+		return err
+	}
+	line, err := c.line()
+	if err != nil {
+		return err
+	}
+	if string(line) != reply {
+		return replyError(line)
+	}
+	return nil
+}
+
+// line reads one CRLF terminated line, excluding the CRLF
+func (c *conn) line() ([]byte, error) {
+	line, err := c.r.ReadSlice('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 2 || line[len(line)-2] != '\r' {
+		return nil, errors.New("memcache: malformed reply")
+	}
+	return line[:len(line)-2], nil
+}
+
+func (c *conn) close() {
+	_ = c.nc.Close()
+}
+
+// Error is an error reply sent by the memcached server, e.g. SERVER_ERROR.
+//
+// After an Error the state of the connection is known, such that it may be
+// reused; any other error causes the connection to be closed.
+type Error string
+
+func (e Error) Error() string {
+	return "memcache: " + string(e)
+}
+
+// replyError returns the error of a reply which is not the expected reply,
+// which is an Error only if the reply is an error reply of the protocol
+func replyError(line []byte) error {
+	switch {
+	case bytes.Equal(line, []byte("ERROR")),
+		bytes.HasPrefix(line, []byte("CLIENT_ERROR ")),
+		bytes.HasPrefix(line, []byte("SERVER_ERROR ")):
+		return Error(line)
+	default:
+		return unexpected(line)
+	}
+}
+
+// unexpected returns the error of a reply which violates the protocol, after
+// which the state of the connection is not known
+func unexpected(line []byte) error {
+	return fmt.Errorf("memcache: unexpected reply %q", line)
+}
@@ -0,0 +1,185 @@
+package memcache
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeServer is an in-process stand-in for a memcached server, implementing
+// the get, set, add, and delete commands of the text protocol.
+type fakeServer struct {
+	listener net.Listener
+
+	lock sync.Mutex
+	now  time.Time
+	data map[string]fakeItem
+	hits int // number of commands received
+}
+
+type fakeItem struct {
+	data       []byte
+	expiration time.Time
+}
+
+func newFakeServer(t *testing.T, now time.Time) *fakeServer {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fs := &fakeServer{
+		listener: listener,
+		now:      now,
+		data:     make(map[string]fakeItem),
+	}
+
+	go fs.serve()
+	t.Cleanup(fs.stop)
+	return fs
+}
+
+func (fs *fakeServer) address() string {
+	return fs.listener.Addr().String()
+}
+
+func (fs *fakeServer) stop() {
+	_ = fs.listener.Close()
+}
+
+func (fs *fakeServer) advance(d time.Duration) {
+	fs.lock.Lock()
+	defer fs.lock.Unlock()
+	fs.now = fs.now.Add(d)
+}
+
+func (fs *fakeServer) count() int {
+	fs.lock.Lock()
+	defer fs.lock.Unlock()
+	return fs.hits
+}
+
+func (fs *fakeServer) serve() {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	conns := make(map[net.Conn]struct{})
+	lock := new(sync.Mutex)
+	defer func() {
+		// stopping the server also severs existing connections
+		lock.Lock()
+		for nc := range conns {
+			_ = nc.Close()
+		}
+		lock.Unlock()
+	}()
+
+	for {
+		nc, err := fs.listener.Accept()
+		if err != nil {
+			return
+		}
+		lock.Lock()
+		conns[nc] = struct{}{}
+		lock.Unlock()
+		wg.Go(func() { fs.handle(nc) })
+	}
+}
+
+func (fs *fakeServer) handle(nc net.Conn) {
+	defer func() { _ = nc.Close() }()
+
+	r := bufio.NewReader(nc)
+	w := bufio.NewWriter(nc)
+
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			return
+		}
+
+		switch fields[0] {
+		case "set", "add":
+			// set <key> <flags> <exptime> <bytes>
+			exptime, _ := strconv.ParseInt(fields[3], 10, 64)
+			size, _ := strconv.Atoi(fields[4])
+			data := make([]byte, size+2)
+			if _, err = io.ReadFull(r, data); err != nil {
+				return
+			}
+			if fs.set(fields[1], data[:size], exptime, fields[0] == "add") {
+				_, _ = w.WriteString("STORED\r\n")
+			} else {
+				_, _ = w.WriteString("NOT_STORED\r\n")
+			}
+		case "get":
+			if data, exists := fs.get(fields[1]); exists {
+				_, _ = fmt.Fprintf(w, "VALUE %s 0 %d\r\n%s\r\nEND\r\n", fields[1], len(data), data)
+			} else {
+				_, _ = w.WriteString("END\r\n")
+			}
+		case "delete":
+			if fs.delete(fields[1]) {
+				_, _ = w.WriteString("DELETED\r\n")
+			} else {
+				_, _ = w.WriteString("NOT_FOUND\r\n")
+			}
+		default:
+			_, _ = w.WriteString("ERROR\r\n")
+		}
+
+		if err = w.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+func (fs *fakeServer) set(key string, data []byte, exptime int64, add bool) bool {
+	fs.lock.Lock()
+	defer fs.lock.Unlock()
+
+	fs.hits++
+	if item, exists := fs.data[key]; add && exists && fs.now.Before(item.expiration) {
+		return false
+	}
+	expiration := fs.now.Add(time.Duration(exptime) * time.Second)
+	if exptime > maxRelative {
+		expiration = time.Unix(exptime, 0)
+	}
+	fs.data[key] = fakeItem{data: data, expiration: expiration}
+	return true
+}
+
+func (fs *fakeServer) get(key string) ([]byte, bool) {
+	fs.lock.Lock()
+	defer fs.lock.Unlock()
+
+	fs.hits++
+	item, exists := fs.data[key]
+	if !exists || !fs.now.Before(item.expiration) {
+		return nil, false
+	}
+	return item.data, true
+}
+
+func (fs *fakeServer) delete(key string) bool {
+	fs.lock.Lock()
+	defer fs.lock.Unlock()
+
+	fs.hits++
+	item, exists := fs.data[key]
+	delete(fs.data, key)
+	return exists && fs.now.Before(item.expiration)
+}
@@ -0,0 +1,345 @@
+// Package memcache provides an implementation of oauth.Cache backed by one or
+// more memcached servers, speaking the memcached text protocol directly.
+package memcache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"cattlecloud.net/go/webtools/middles/oauth"
+)
+
+var (
+	// ErrNoServers indicates there are no live memcached servers.
+	ErrNoServers = errors.New("memcache: no servers available")
+
+	// ErrKeyNotValid indicates a key is too long, or contains whitespace or
+	// control characters.
+	ErrKeyNotValid = errors.New("memcache: key not valid")
+)
+
+const (
+	// maxKeyLength is the longest key accepted by memcached
+	maxKeyLength = 250
+
+	// maxRelative is the longest exptime memcached interprets as a relative
+	// number of seconds, rather than an absolute unix timestamp
+	maxRelative = 30 * 24 * 60 * 60
+)
+
+type Options struct {
+	servers  []string
+	prefix   string
+	poolSize int
+	timeout  time.Duration
+	retry    time.Duration
+	dialer   func(context.Context, string) (net.Conn, error)
+}
+
+type OptionFunc func(*Options)
+
+// SetServers sets the host:port addresses of the memcached servers. Keys are
+// spread across the servers by consistent hashing. The default server is
+// localhost:11211.
+func SetServers(addresses ...string) OptionFunc {
+	return func(o *Options) { o.servers = addresses }
+}
+
+// SetPrefix sets a prefix applied to every key, enabling many caches to share
+// the memcached servers.
+func SetPrefix(prefix string) OptionFunc {
+	return func(o *Options) { o.prefix = prefix }
+}
+
+// SetPoolSize sets the maximum number of idle connections kept to each server.
+func SetPoolSize(size int) OptionFunc {
+	return func(o *Options) { o.poolSize = size }
+}
+
+// SetTimeout sets the timeout of operations which are not given a context, or
+// are given a context with no deadline.
+func SetTimeout(timeout time.Duration) OptionFunc {
+	return func(o *Options) { o.timeout = timeout }
+}
+
+// SetRetryDead sets how long a server which failed is skipped over, before
+// being tried again.
+func SetRetryDead(retry time.Duration) OptionFunc {
+	return func(o *Options) { o.retry = retry }
+}
+
+// SetDialer overrides how connections to memcached servers are established.
+func SetDialer(dialer func(context.Context, string) (net.Conn, error)) OptionFunc {
+	return func(o *Options) { o.dialer = dialer }
+}
+
+// New creates a Cache backed by memcached servers, using codec to encode and
+// decode values.
+func New[T any](codec oauth.Codec[T], opts ...OptionFunc) *Cache[T] {
+	d := new(net.Dialer)
+	options := &Options{
+		servers:  []string{"localhost:11211"},
+		poolSize: 4,
+		timeout:  5 * time.Second,
+		retry:    30 * time.Second,
+		dialer: func(ctx context.Context, address string) (net.Conn, error) {
+			return d.DialContext(ctx, "tcp", address)
+		},
+	}
+
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	return &Cache[T]{
+		codec:   codec,
+		ring:    newRing(options.servers, options.poolSize),
+		prefix:  options.prefix,
+		timeout: options.timeout,
+		retry:   options.retry,
+		dialer:  options.dialer,
+		clock:   time.Now,
+	}
+}
+
+// Cache is an implementation of oauth.Cache backed by memcached servers.
+//
+// Cache implements oauth.ContextCache, oauth.Taker, and oauth.Adder, and
+// operations without a context which fail are treated as cache misses.
+type Cache[T any] struct {
+	codec   oauth.Codec[T]
+	ring    *ring
+	prefix  string
+	timeout time.Duration
+	retry   time.Duration
+	dialer  func(context.Context, string) (net.Conn, error)
+	clock   func() time.Time
+}
+
+func (c *Cache[T]) Get(key string) (T, bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	value, exists, _ := c.GetContext(ctx, key)
+	return value, exists
+}
+
+func (c *Cache[T]) Put(key string, value T, ttl time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	_ = c.PutContext(ctx, key, value, ttl)
+}
+
+func (c *Cache[T]) Delete(key string) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	_ = c.DeleteContext(ctx, key)
+}
+
+func (c *Cache[T]) GetContext(ctx context.Context, key string) (T, bool, error) {
+	var (
+		data   []byte
+		exists bool
+		empty  T
+	)
+
+	err := c.do(ctx, key, func(cn *conn, k string) error {
+		var err error
+		data, exists, err = cn.get(k)
+		return err
+	})
+
+	if err != nil || !exists {
+		return empty, false, err
+	}
+
+	value, derr := c.codec.Decode(data)
+	if derr != nil {
+		return empty, false, fmt.Errorf("memcache: unable to decode value: %w", derr)
+	}
+
+	return value, true, nil
+}
+
+func (c *Cache[T]) PutContext(ctx context.Context, key string, value T, ttl time.Duration) error {
+	data, err := c.codec.Encode(value)
+	if err != nil {
+		return fmt.Errorf("memcache: unable to encode value: %w", err)
+	}
+
+	exptime := expiration(c.clock(), ttl)
+	return c.do(ctx, key, func(cn *conn, k string) error {
+		return cn.set(k, data, exptime)
+	})
+}
+
+// Add sets key only if key does not exist, using the add command.
+func (c *Cache[T]) Add(ctx context.Context, key string, value T, ttl time.Duration) (bool, error) {
+	data, err := c.codec.Encode(value)
+	if err != nil {
+		return false, fmt.Errorf("memcache: unable to encode value: %w", err)
+	}
+
+	var added bool
+	exptime := expiration(c.clock(), ttl)
+	err = c.do(ctx, key, func(cn *conn, k string) error {
+		var aerr error
+		added, aerr = cn.add(k, data, exptime)
+		return aerr
+	})
+	return added, err
+}
+
+func (c *Cache[T]) DeleteContext(ctx context.Context, key string) error {
+	return c.do(ctx, key, func(cn *conn, k string) error {
+		_, err := cn.delete(k)
+		return err
+	})
+}
+
+// Take atomically gets and deletes key. The memcached text protocol has no
+// single command for this; instead the item is read and then deleted, and only
+// the caller whose delete succeeds receives the item.
+func (c *Cache[T]) Take(ctx context.Context, key string) (T, bool, error) {
+	var (
+		data   []byte
+		exists bool
+		empty  T
+	)
+
+	err := c.do(ctx, key, func(cn *conn, k string) error {
+		var err error
+		if data, exists, err = cn.get(k); err != nil || !exists {
+			return err
+		}
+		exists, err = cn.delete(k)
+		return err
+	})
+
+	if err != nil || !exists {
+		return empty, false, err
+	}
+
+	value, derr := c.codec.Decode(data)
+	if derr != nil {
+		return empty, false, fmt.Errorf("memcache: unable to decode value: %w", derr)
+	}
+
+	return value, true, nil
+}
+
+// Close all idle connections to the memcached servers.
+func (c *Cache[T]) Close() error {
+	for _, n := range c.ring.nodes {
+	drain:
+		for {
+			select {
+			case cn := <-n.idle:
+				cn.close()
+			default:
+				break drain
+			}
+		}
+	}
+	return nil
+}
+
+// do runs f on a connection to the server responsible for key; if the server
+// fails, it is marked dead and f is tried again on the next live server
+func (c *Cache[T]) do(ctx context.Context, key string, f func(*conn, string) error) error {
+	key = c.prefix + key
+	if !validKey(key) {
+		return ErrKeyNotValid
+	}
+
+	for range c.ring.nodes {
+		now := c.clock()
+
+		n, ok := c.ring.lookup(key, now)
+		if !ok {
+			return ErrNoServers
+		}
+
+		err := c.on(ctx, n, key, f)
+
+		var serverErr Error
+		switch {
+		case err == nil:
+			return nil
+		case errors.As(err, &serverErr):
+			return err
+		case ctx.Err() != nil:
+			return fmt.Errorf("memcache: request failed: %w", err)
+		default:
+			n.kill(now.Add(c.retry))
+		}
+	}
+
+	return ErrNoServers
+}
+
+func (c *Cache[T]) on(ctx context.Context, n *node, key string, f func(*conn, string) error) error {
+	var cn *conn
+	select {
+	case cn = <-n.idle:
+	default:
+		nc, err := c.dialer(ctx, n.address)
+		if err != nil {
+			return err
+		}
+		cn = newConn(nc)
+	}
+
+	if err := cn.deadline(ctx, c.timeout); err != nil {
+		cn.close()
+		return err
+	}
+
+	err := f(cn, key)
+
+	// connections are only reused if their state is known
+	var serverErr Error
+	if err != nil && !errors.As(err, &serverErr) {
+		cn.close()
+		return err
+	}
+
+	select {
+	case n.idle <- cn:
+	default:
+		cn.close()
+	}
+
+	return err
+}
+
+// expiration converts ttl into a memcached exptime, which is either a relative
+// number of seconds, or an absolute unix time for long durations
+func expiration(now time.Time, ttl time.Duration) int64 {
+	seconds := int64((ttl + time.Second - 1) / time.Second) // round up
+	switch {
+	case seconds < 1:
+		return 1
+	case seconds > maxRelative:
+		return now.Add(ttl).Unix()
+	default:
+		return seconds
+	}
+}
+
+func validKey(key string) bool {
+	if key == "" || len(key) > maxKeyLength {
+		return false
+	}
+	for i := range len(key) {
+		if key[i] <= ' ' || key[i] == 0x7f {
+			return false
+		}
+	}
+	return true
+}
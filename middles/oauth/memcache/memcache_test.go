@@ -0,0 +1,262 @@
+package memcache
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"cattlecloud.net/go/webtools/middles/oauth"
+	"github.com/shoenig/test/must"
+)
+
+var (
+	_ oauth.Cache[string, int]        = (*Cache[int])(nil)
+	_ oauth.ContextCache[string, int] = (*Cache[int])(nil)
+	_ oauth.Deleter[string]           = (*Cache[int])(nil)
+	_ oauth.Taker[string, int]        = (*Cache[int])(nil)
+	_ oauth.Adder[string, int]        = (*Cache[int])(nil)
+)
+
+func testNow() time.Time {
+	return time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+}
+
+func TestCache_GetPutDelete(t *testing.T) {
+	t.Parallel()
+
+	fs := newFakeServer(t, testNow())
+	c := New(oauth.JSONCodec[string]{}, SetServers(fs.address()))
+	c.clock = testNow
+	t.Cleanup(func() { _ = c.Close() })
+
+	ctx := context.Background()
+
+	_, exists, err := c.GetContext(ctx, "missing")
+	must.NoError(t, err)
+	must.False(t, exists)
+
+	must.NoError(t, c.PutContext(ctx, "key", "hello", 1*time.Minute))
+	value, exists, err := c.GetContext(ctx, "key")
+	must.NoError(t, err)
+	must.True(t, exists)
+	must.Eq(t, "hello", value)
+
+	must.NoError(t, c.DeleteContext(ctx, "key"))
+	_, exists = c.Get("key")
+	must.False(t, exists)
+}
+
+func TestCache_Take(t *testing.T) {
+	t.Parallel()
+
+	fs := newFakeServer(t, testNow())
+	c := New(oauth.JSONCodec[string]{}, SetServers(fs.address()))
+	c.clock = testNow
+	t.Cleanup(func() { _ = c.Close() })
+
+	ctx := context.Background()
+
+	c.Put("key", "hello", 1*time.Minute)
+	value, exists, err := c.Take(ctx, "key")
+	must.NoError(t, err)
+	must.True(t, exists)
+	must.Eq(t, "hello", value)
+
+	_, exists, err = c.Take(ctx, "key")
+	must.NoError(t, err)
+	must.False(t, exists)
+}
+
+func TestCache_Add(t *testing.T) {
+	t.Parallel()
+
+	fs := newFakeServer(t, testNow())
+	c := New(oauth.JSONCodec[string]{}, SetServers(fs.address()))
+	c.clock = testNow
+	t.Cleanup(func() { _ = c.Close() })
+
+	ctx := context.Background()
+
+	added, err := c.Add(ctx, "key", "first", 1*time.Minute)
+	must.NoError(t, err)
+	must.True(t, added)
+
+	added, err = c.Add(ctx, "key", "second", 1*time.Minute)
+	must.NoError(t, err)
+	must.False(t, added)
+
+	value, exists := c.Get("key")
+	must.True(t, exists)
+	must.Eq(t, "first", value)
+
+	// an expired item may be added again
+	fs.advance(2 * time.Minute)
+	added, err = c.Add(ctx, "key", "third", 1*time.Minute)
+	must.NoError(t, err)
+	must.True(t, added)
+}
+
+func TestCache_exptime(t *testing.T) {
+	t.Parallel()
+
+	fs := newFakeServer(t, testNow())
+	c := New(oauth.JSONCodec[int]{}, SetServers(fs.address()))
+	c.clock = testNow
+	t.Cleanup(func() { _ = c.Close() })
+
+	c.Put("short", 1, 1*time.Minute)
+	c.Put("long", 2, 60*24*time.Hour) // sent as absolute time
+
+	fs.advance(2 * time.Minute)
+	_, exists := c.Get("short")
+	must.False(t, exists)
+
+	_, exists = c.Get("long")
+	must.True(t, exists)
+
+	fs.advance(60 * 24 * time.Hour)
+	_, exists = c.Get("long")
+	must.False(t, exists)
+}
+
+func TestCache_expiration(t *testing.T) {
+	t.Parallel()
+
+	now := testNow()
+	must.Eq(t, 1, expiration(now, 0))
+	must.Eq(t, 1, expiration(now, 10*time.Millisecond))
+	must.Eq(t, 2, expiration(now, 1500*time.Millisecond))
+	must.Eq(t, 3600, expiration(now, 1*time.Hour))
+	must.Eq(t, now.Add(31*24*time.Hour).Unix(), expiration(now, 31*24*time.Hour))
+}
+
+func TestCache_keys(t *testing.T) {
+	t.Parallel()
+
+	fs := newFakeServer(t, testNow())
+	c := New(oauth.JSONCodec[int]{}, SetServers(fs.address()), SetPrefix("p:"))
+	t.Cleanup(func() { _ = c.Close() })
+
+	ctx := context.Background()
+	must.ErrorIs(t, c.PutContext(ctx, "has space", 1, time.Minute), ErrKeyNotValid)
+	must.ErrorIs(t, c.PutContext(ctx, strings.Repeat("a", 250), 1, time.Minute), ErrKeyNotValid)
+
+	must.NoError(t, c.PutContext(ctx, "key", 1, time.Minute))
+	fs.lock.Lock()
+	must.MapContainsKey(t, fs.data, "p:key")
+	fs.lock.Unlock()
+}
+
+func TestCache_distribution(t *testing.T) {
+	t.Parallel()
+
+	servers := []*fakeServer{
+		newFakeServer(t, testNow()),
+		newFakeServer(t, testNow()),
+		newFakeServer(t, testNow()),
+	}
+
+	c := New(oauth.JSONCodec[int]{}, SetServers(
+		servers[0].address(),
+		servers[1].address(),
+		servers[2].address(),
+	))
+	c.clock = testNow
+	t.Cleanup(func() { _ = c.Close() })
+
+	for i := range 300 {
+		c.Put("key-"+strconv.Itoa(i), i, 1*time.Minute)
+	}
+
+	// every server holds a reasonable share of the keys
+	for _, fs := range servers {
+		must.Between(t, 50, fs.count(), 150)
+	}
+}
+
+func TestCache_deadNode(t *testing.T) {
+	t.Parallel()
+
+	a := newFakeServer(t, testNow())
+	b := newFakeServer(t, testNow())
+
+	now := testNow()
+	c := New(oauth.JSONCodec[int]{}, SetServers(a.address(), b.address()), SetRetryDead(1*time.Minute))
+	c.clock = func() time.Time { return now }
+	t.Cleanup(func() { _ = c.Close() })
+
+	// find a key which belongs to server a
+	var key string
+	for i := 0; ; i++ {
+		key = "key-" + strconv.Itoa(i)
+		if n, _ := c.ring.lookup(key, now); n.address == a.address() {
+			break
+		}
+	}
+
+	ctx := context.Background()
+	must.NoError(t, c.PutContext(ctx, key, 1, 1*time.Hour))
+	must.Eq(t, 1, a.count())
+
+	// with server a down, the key moves to server b
+	a.stop()
+	must.NoError(t, c.PutContext(ctx, key, 2, 1*time.Hour))
+	value, exists, err := c.GetContext(ctx, key)
+	must.NoError(t, err)
+	must.True(t, exists)
+	must.Eq(t, 2, value)
+	must.Eq(t, 2, b.count())
+
+	// with both servers down, there are no servers
+	b.stop()
+	_, _, err = c.GetContext(ctx, key)
+	must.ErrorIs(t, err, ErrNoServers)
+
+	// dead servers are skipped until the retry interval has passed
+	now = now.Add(2 * time.Minute)
+	_, _, err = c.GetContext(ctx, key)
+	must.ErrorIs(t, err, ErrNoServers)
+}
+
+func TestConn_replies(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name   string
+		reply  string
+		server bool // an Error, after which the connection may be reused
+	}{
+		{name: "server error", reply: "SERVER_ERROR out of memory\r\n", server: true},
+		{name: "client error", reply: "CLIENT_ERROR bad data chunk\r\n", server: true},
+		{name: "error", reply: "ERROR\r\n", server: true},
+		{name: "malformed value", reply: "VALUE key 0\r\n"},
+		{name: "unknown reply", reply: "STORED\r\n"},
+		{name: "missing end", reply: "VALUE key 0 1\r\n1\r\nVALUE other 0 1\r\n2\r\nEND\r\n"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			client, server := net.Pipe()
+			t.Cleanup(func() { _ = client.Close() })
+
+			go func() {
+				defer func() { _ = server.Close() }()
+				if _, err := bufio.NewReader(server).ReadString('\n'); err != nil {
+					return
+				}
+				_, _ = server.Write([]byte(tc.reply))
+			}()
+
+			_, _, err := newConn(client).get("key")
+			must.Error(t, err)
+
+			var serverErr Error
+			must.Eq(t, tc.server, errors.As(err, &serverErr))
+		})
+	}
+}
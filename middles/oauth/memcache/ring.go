@@ -0,0 +1,117 @@
+package memcache
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// replicas is the number of points on the ring for each server, smoothing the
+// distribution of keys across servers
+const replicas = 160
+
+// ring implements consistent hashing of keys across servers, such that adding
+// or removing a server only moves the keys of that server
+type ring struct {
+	points []point // sorted by hash
+	nodes  []*node
+}
+
+type point struct {
+	hash uint32
+	node *node
+}
+
+// node is one memcached server
+type node struct {
+	address string
+	idle    chan *conn
+
+	lock  sync.Mutex
+	until time.Time // node is considered dead until this time
+}
+
+func newRing(addresses []string, poolSize int) *ring {
+	r := &ring{
+		points: make([]point, 0, len(addresses)*replicas),
+		nodes:  make([]*node, 0, len(addresses)),
+	}
+
+	for _, address := range addresses {
+		n := &node{
+			address: address,
+			idle:    make(chan *conn, poolSize),
+		}
+		r.nodes = append(r.nodes, n)
+		for i := range replicas {
+			r.points = append(r.points, point{
+				hash: hash(address + "-" + strconv.Itoa(i)),
+				node: n,
+			})
+		}
+	}
+
+	slices.SortFunc(r.points, func(a, b point) int {
+		switch {
+		case a.hash < b.hash:
+			return -1
+		case a.hash > b.hash:
+			return 1
+		default:
+			return 0
+		}
+	})
+
+	return r
+}
+
+// lookup the node responsible for key, skipping over nodes which are dead
+func (r *ring) lookup(key string, now time.Time) (*node, bool) {
+	if len(r.points) == 0 {
+		return nil, false
+	}
+
+	h := hash(key)
+	start, _ := slices.BinarySearchFunc(r.points, h, func(p point, h uint32) int {
+		switch {
+		case p.hash < h:
+			return -1
+		case p.hash > h:
+			return 1
+		default:
+			return 0
+		}
+	})
+
+	// walk clockwise around the ring until finding a live node
+	for i := range r.points {
+		n := r.points[(start+i)%len(r.points)].node
+		if n.alive(now) {
+			return n, true
+		}
+	}
+
+	return nil, false
+}
+
+// hash s onto the ring; a cryptographic hash is not required, but provides a
+// uniform distribution regardless of the similarity of the inputs
+func hash(s string) uint32 {
+	sum := sha256.Sum256([]byte(s))
+	return binary.BigEndian.Uint32(sum[:4])
+}
+
+func (n *node) alive(now time.Time) bool {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	return !now.Before(n.until)
+}
+
+func (n *node) kill(until time.Time) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	n.until = until
+}
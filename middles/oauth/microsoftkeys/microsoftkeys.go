@@ -1,6 +1,7 @@
 package microsoftkeys
 
 import (
+	"context"
 	"crypto/rsa"
 	"crypto/x509"
 	"encoding/base64"
@@ -14,6 +15,8 @@ import (
 
 	"cattlecloud.net/go/scope"
 	"cattlecloud.net/go/webtools/middles/oauth"
+	"cattlecloud.net/go/webtools/middles/oauth/jwks"
+	"cattlecloud.net/go/webtools/middles/oauth/keyfetch"
 
 	"github.com/golang-jwt/jwt/v5"
 )
@@ -24,17 +27,26 @@ const public = "https://login.microsoftonline.com/common/discovery/v2.0/keys"
 type Claims struct {
 	// JWT standard types (scope: oidc)
 	jwt.RegisteredClaims
+	Nonce string `json:"nonce"`
 
 	// Microsoft custom types (scope: email)
 	Email         string `json:"email"`
 	EmailVerified bool   `json:"email_verified"`
 }
 
+// GetNonce returns the nonce claim, which must match the nonce sent with the
+// authorization request.
+func (c *Claims) GetNonce() string {
+	return c.Nonce
+}
+
 type Options struct {
 	endpoint   string
-	cache      oauth.Cache[string, string]
+	cache      oauth.Cache[string, *rsa.PublicKey]
 	httpClient *http.Client
 	clientID   string
+	keySet     *jwks.KeySet
+	fetcher    *keyfetch.Fetcher
 }
 
 type OptionFunc func(*Options)
@@ -51,10 +63,27 @@ func SetEndpoint(s string) OptionFunc {
 	return func(o *Options) { o.endpoint = s }
 }
 
+func SetCache(c oauth.Cache[string, *rsa.PublicKey]) OptionFunc {
+	return func(o *Options) { o.cache = c }
+}
+
+// SetKeySet sets a shared jwks.KeySet from which public keys are looked up,
+// instead of the endpoint of the validator.
+func SetKeySet(ks *jwks.KeySet) OptionFunc {
+	return func(o *Options) { o.keySet = ks }
+}
+
+// SetFetcher sets the keyfetch.Fetcher of the public keys, e.g. to change the
+// bounds of how long keys are cached. By default the keys of the endpoint are
+// fetched using the http client of the validator.
+func SetFetcher(f *keyfetch.Fetcher) OptionFunc {
+	return func(o *Options) { o.fetcher = f }
+}
+
 func New(opts ...OptionFunc) Validator {
 	options := &Options{
 		endpoint:   public,
-		cache:      oauth.NewVolatileCache[string](8),
+		cache:      oauth.NewVolatileCache[*rsa.PublicKey](32), // microsoft publishes many keys
 		httpClient: &http.Client{Timeout: 1 * time.Minute},
 	}
 
@@ -62,11 +91,15 @@ func New(opts ...OptionFunc) Validator {
 		opt(options)
 	}
 
+	if options.fetcher == nil {
+		options.fetcher = keyfetch.New(options.endpoint, keyfetch.SetHTTP(options.httpClient))
+	}
+
 	return &validator{
-		vc:  options.cache,
-		hc:  options.httpClient,
-		id:  options.clientID,
-		url: options.endpoint,
+		vc: oauth.NewLoadingCache(options.cache),
+		kf: options.fetcher,
+		id: options.clientID,
+		ks: options.keySet,
 	}
 }
 
@@ -75,10 +108,10 @@ type Validator interface {
 }
 
 type validator struct {
-	vc  oauth.Cache[string, string]
-	hc  *http.Client
-	id  string
-	url string
+	vc *oauth.LoadingCache[*rsa.PublicKey]
+	kf *keyfetch.Fetcher
+	id string
+	ks *jwks.KeySet
 }
 
 func (v *validator) Validate(token string) (*Claims, error) {
@@ -91,28 +124,12 @@ func (v *validator) Validate(token string) (*Claims, error) {
 		claims,
 		func(t *jwt.Token) (any, error) {
 			keyID := fmt.Sprintf("%s", t.Header["kid"])
-			cert64, err0 := v.getMicrosoftCert(keyID)
-			if err0 != nil {
-				return nil, err0
-			}
-
-			certBytes, err1 := base64.StdEncoding.DecodeString(cert64)
-			if err1 != nil {
-				return nil, err1
-			}
-
-			cert509, err2 := x509.ParseCertificate(certBytes)
-			if err2 != nil {
-				return nil, err2
-			}
-
-			certPub, ok := cert509.PublicKey.(*rsa.PublicKey)
-			if !ok {
-				return nil, errors.New("oauth/microsoftkeys: cannot convert x509 certificate")
+			if v.ks != nil {
+				return v.getKey(keyID)
 			}
-
-			return certPub, nil
+			return v.getMicrosoftCert(keyID)
 		},
+		jwt.WithValidMethods([]string{"RS256"}),
 	)
 
 	// unable to get token or parse it
@@ -142,56 +159,72 @@ func (v *validator) Validate(token string) (*Claims, error) {
 	return claims2, nil
 }
 
-func (v *validator) getMicrosoftCert(keyID string) (string, error) {
-	public, exists := v.vc.Get(keyID)
+func (v *validator) getKey(keyID string) (any, error) {
+	ctx, cancel := scope.TTL(30 * time.Second)
+	defer cancel()
 
-	switch {
-	case exists:
-		return public, nil
-	default:
-		// no such certificate in the cache;
-		// continue with http request to microsoft for a certificate
-	}
+	return v.ks.Key(ctx, keyID)
+}
 
+func (v *validator) getMicrosoftCert(keyID string) (*rsa.PublicKey, error) {
 	ctx, cancel := scope.TTL(30 * time.Second)
 	defer cancel()
 
-	request, _ := http.NewRequestWithContext(ctx, http.MethodGet, v.url, nil)
-	response, err := v.hc.Do(request)
-	if err != nil {
-		return "", err
+	// concurrent lookups of the same missing key result in one fetch
+	return v.vc.GetOrLoad(ctx, keyID, func(ctx context.Context) (*rsa.PublicKey, time.Duration, error) {
+		return keyfetch.Load(ctx, v.kf, keyID, v.parseMicrosoftCerts)
+	})
+}
+
+// parseMicrosoftCerts finds the key of keyID among the Microsoft certificates
+// of body, putting the other keys into the cache
+func (v *validator) parseMicrosoftCerts(ctx context.Context, body []byte, keyID string, ttl time.Duration) (*rsa.PublicKey, bool, error) {
+	var data struct {
+		Keys []struct {
+			Kid string   `json:"kid"`
+			X5c []string `json:"x5c"`
+		} `json:"keys"`
 	}
-	defer func() { _ = response.Body.Close() }()
 
-	data := make(map[string]any)
-	if err := json.NewDecoder(response.Body).Decode(&data); err != nil {
-		return "", err
+	if err := json.Unmarshal(body, &data); err != nil {
+		return nil, false, errors.New("oauth/microsoftkeys: Microsoft keys in unexpected format")
 	}
 
-	keys, ok := data["keys"].([]any)
-	if !ok {
-		return "", errors.New("oauth/microsoftkeys: Microsoft keys in unexpected format")
+	keys := make(map[string]*rsa.PublicKey, len(data.Keys))
+	for _, key := range data.Keys {
+		if len(key.X5c) == 0 {
+			continue
+		}
+
+		public, perr := parseCert(key.X5c[0])
+		switch {
+		case perr == nil:
+			keys[key.Kid] = public
+		case key.Kid == keyID:
+			return nil, false, perr
+		}
 	}
 
-	var wanted string
+	key, found := keyfetch.Pick(ctx, v.vc, keys, keyID, ttl)
+	return key, found, nil
+}
 
-	// iterate each key and put it into the cache
-	for _, item := range keys {
-		key := item.(map[string]any)
-		id := key["kid"].(string)
-		value := key["x5c"].([]any)[0].(string)
-		v.vc.Put(id, value, 1*time.Hour)
+// parseCert returns the RSA public key of a base64 encoded x509 certificate
+func parseCert(cert64 string) (*rsa.PublicKey, error) {
+	certBytes, err := base64.StdEncoding.DecodeString(cert64)
+	if err != nil {
+		return nil, err
+	}
 
-		// hold onto the key we were looking for if we see it
-		if id == keyID {
-			wanted = value
-		}
+	cert509, err := x509.ParseCertificate(certBytes)
+	if err != nil {
+		return nil, err
 	}
 
-	// did we find the key we were looking for?
-	if wanted == "" {
-		return "", errors.New("oauth/microsoftkeys: no Microsoft key found")
+	certPub, ok := cert509.PublicKey.(*rsa.PublicKey)
+	if !ok {
+		return nil, errors.New("oauth/microsoftkeys: cannot convert x509 certificate")
 	}
 
-	return wanted, nil
+	return certPub, nil
 }
@@ -13,6 +13,8 @@ import (
 	"testing"
 	"time"
 
+	"cattlecloud.net/go/webtools/middles/oauth/internal/keytest"
+	"cattlecloud.net/go/webtools/middles/oauth/jwks"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/shoenig/test/must"
 )
@@ -97,3 +99,75 @@ func TestValidator_Validate(t *testing.T) {
 	must.Eq(t, "ms-tester@example.com", validatedClaims.Email)
 	must.Eq(t, "ms-user-789", validatedClaims.Subject)
 }
+
+func TestValidator_Validate_keySet(t *testing.T) {
+	t.Parallel()
+
+	const clientID = "test-shared-client"
+
+	now := time.Now()
+	claims := &Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    "https://login.microsoftonline.com/common/v2.0",
+			Audience:  jwt.ClaimStrings{clientID},
+			ExpiresAt: jwt.NewNumericDate(now.Add(1 * time.Hour)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			Subject:   "shared-user-123",
+		},
+		EmailVerified: true,
+	}
+
+	keytest.RS256Only(t, func(ks *jwks.KeySet) func(string) error {
+		v := New(SetClientID(clientID), SetKeySet(ks))
+		return func(token string) error {
+			_, err := v.Validate(token)
+			return err
+		}
+	}, claims)
+}
+
+func BenchmarkValidator_Validate(b *testing.B) {
+	const kid = "test-microsoft-kid"
+	const clientID = "test-ms-client"
+
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	must.NoError(b, err)
+
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	certBytes, err := x509.CreateCertificate(rand.Reader, &template, &template, &privateKey.PublicKey, privateKey)
+	must.NoError(b, err)
+	certBase64 := base64.StdEncoding.EncodeToString(certBytes)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"keys": []map[string]any{{"kid": kid, "x5c": []string{certBase64}}},
+		})
+	}))
+	b.Cleanup(ts.Close)
+
+	v := New(SetHTTP(ts.Client()), SetClientID(clientID), SetEndpoint(ts.URL))
+
+	now := time.Now().UTC()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, &Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    "https://login.microsoftonline.com/common/v2.0",
+			Audience:  jwt.ClaimStrings{clientID},
+			ExpiresAt: jwt.NewNumericDate(now.Add(1 * time.Hour)),
+		},
+	})
+	token.Header["kid"] = kid
+	signedToken, err := token.SignedString(privateKey)
+	must.NoError(b, err)
+
+	b.ReportAllocs()
+	for b.Loop() {
+		if _, verr := v.Validate(signedToken); verr != nil {
+			b.Fatal(verr)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package nonces
+
+import (
+	"fmt"
+	"time"
+
+	"cattlecloud.net/go/scope"
+	"cattlecloud.net/go/webtools/middles/oauth"
+	"github.com/shoenig/go-conceal"
+)
+
+// Store is an oauth.Cache capable of atomically taking an item, as needed to
+// ensure each nonce is consumed only once. The value of each item is the time
+// the nonce expires.
+type Store interface {
+	oauth.Cache[string, time.Time]
+	oauth.Taker[string, time.Time]
+}
+
+// NewCached creates a Mint whose nonces are kept in store, which may be shared
+// among processes (e.g. memcached, redis, etc.). Each nonce is consumed only
+// once, even by concurrent callers across processes.
+//
+// If a nonce cannot be written to store, Create still returns the nonce, which
+// will fail to be consumed.
+//
+// The capacity option does not apply to cached nonces.
+func NewCached(store Store, opts ...OptionFunc) Mint {
+	options := &Options{
+		ttl:   10 * time.Minute,
+		clock: time.Now,
+	}
+
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	return &cached{
+		store: store,
+		ttl:   options.ttl,
+		clock: options.clock,
+	}
+}
+
+type cached struct {
+	store Store
+	ttl   time.Duration
+	clock func() time.Time
+}
+
+func (c *cached) Create() *conceal.Text {
+	token := conceal.UUIDv4()
+	expiration := c.clock().Add(c.ttl)
+
+	ctx, cancel := scope.TTL(10 * time.Second)
+	defer cancel()
+
+	_ = oauth.Put(ctx, c.store, token.Unveil(), expiration, c.ttl)
+	return token
+}
+
+func (c *cached) Consume(proposal *conceal.Text) error {
+	now := c.clock()
+
+	ctx, cancel := scope.TTL(10 * time.Second)
+	defer cancel()
+
+	expiration, exists, err := c.store.Take(ctx, proposal.Unveil())
+	switch {
+	case err != nil:
+		return fmt.Errorf("nonces: unable to consume nonce: %w", err)
+	case !exists:
+		return ErrTokenNotValid
+	case now.After(expiration):
+		// the store may retain items beyond their ttl (e.g. memcached, which
+		// expires items on whole seconds)
+		return ErrTokenExpired
+	}
+
+	return nil
+}
@@ -0,0 +1,84 @@
+package nonces
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"cattlecloud.net/go/webtools/middles/oauth"
+	"cattlecloud.net/go/webtools/middles/oauth/expvarsink"
+	"github.com/shoenig/test/must"
+)
+
+func TestCached_normal(t *testing.T) {
+	t.Parallel()
+
+	m := NewCached(oauth.NewVolatileCache[time.Time](100))
+
+	token := m.Create()
+	must.UUIDv4(t, token.Unveil())
+
+	err := m.Consume(token)
+	must.NoError(t, err)
+
+	err2 := m.Consume(token)
+	must.ErrorIs(t, err2, ErrTokenNotValid)
+}
+
+func TestCached_expired(t *testing.T) {
+	t.Parallel()
+
+	// the store retains the nonce beyond its ttl
+	store := oauth.NewVolatileCache[time.Time](100)
+	m := NewCached(store, SetTTL(1*time.Minute)).(*cached)
+
+	now := time.Now()
+	m.clock = func() time.Time { return now }
+	token := m.Create()
+
+	now = now.Add(2 * time.Minute)
+	err := m.Consume(token)
+	must.ErrorIs(t, err, ErrTokenExpired)
+}
+
+func TestCached_concurrent(t *testing.T) {
+	t.Parallel()
+
+	stores := map[string]Store{
+		"volatile":     oauth.NewVolatileCache[time.Time](100),
+		"sharded":      oauth.NewShardedCache[time.Time](4, 100),
+		"instrumented": oauth.Instrument("nonces", oauth.NewVolatileCache[time.Time](100), expvarsink.New("nonces_test")),
+	}
+
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			// replicas share only the store
+			replicas := []Mint{NewCached(store), NewCached(store), NewCached(store)}
+			token := replicas[0].Create()
+
+			var (
+				wg        sync.WaitGroup
+				succeeded atomic.Int32
+				rejected  atomic.Int32
+			)
+
+			for i := range 30 {
+				wg.Go(func() {
+					err := replicas[i%len(replicas)].Consume(token)
+					switch {
+					case err == nil:
+						succeeded.Add(1)
+					case errors.Is(err, ErrTokenNotValid):
+						rejected.Add(1)
+					}
+				})
+			}
+			wg.Wait()
+
+			must.Eq(t, 1, succeeded.Load())
+			must.Eq(t, 29, rejected.Load())
+		})
+	}
+}
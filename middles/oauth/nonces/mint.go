@@ -1,15 +1,17 @@
 package nonces
 
 import (
+	"container/list"
 	"errors"
 	"sync"
+	"time"
 
-	"github.com/hashicorp/go-set/v3"
 	"github.com/shoenig/go-conceal"
 )
 
 var (
 	ErrTokenNotValid = errors.New("token not valid")
+	ErrTokenExpired  = errors.New("token expired")
 )
 
 type Mint interface {
@@ -17,34 +19,104 @@ type Mint interface {
 	Consume(*conceal.Text) error
 }
 
-func New() Mint {
+type Options struct {
+	ttl      time.Duration
+	capacity int
+	clock    func() time.Time
+}
+
+type OptionFunc func(*Options)
+
+// SetTTL sets how long a nonce can be consumed after being created. The
+// default TTL is 10 minutes.
+func SetTTL(ttl time.Duration) OptionFunc {
+	return func(o *Options) { o.ttl = ttl }
+}
+
+// SetCapacity sets the maximum number of unconsumed nonces, beyond which the
+// oldest nonces are discarded. The default capacity is 10,000.
+func SetCapacity(capacity int) OptionFunc {
+	return func(o *Options) { o.capacity = capacity }
+}
+
+func New(opts ...OptionFunc) Mint {
+	options := &Options{
+		ttl:      10 * time.Minute,
+		capacity: 10_000,
+		clock:    time.Now,
+	}
+
+	for _, opt := range opts {
+		opt(options)
+	}
+
 	return &mint{
-		lock:   new(sync.Mutex),
-		active: set.NewHashSet[*conceal.Text](4),
+		lock:     new(sync.Mutex),
+		active:   make(map[string]*list.Element),
+		order:    list.New(),
+		ttl:      options.ttl,
+		capacity: max(options.capacity, 1),
+		clock:    options.clock,
 	}
 }
 
 type mint struct {
-	lock   *sync.Mutex
-	active *set.HashSet[*conceal.Text, int]
+	lock     *sync.Mutex
+	active   map[string]*list.Element // of *nonce
+	order    *list.List               // front is oldest
+	ttl      time.Duration
+	capacity int
+	clock    func() time.Time
+}
+
+type nonce struct {
+	value      string
+	expiration time.Time
 }
 
 func (m *mint) Create() *conceal.Text {
 	token := conceal.UUIDv4()
+	expiration := m.clock().Add(m.ttl)
+
 	m.lock.Lock()
-	m.active.Insert(token)
-	m.lock.Unlock()
+	defer m.lock.Unlock()
+
+	// discard the oldest nonces to make room; being the oldest these are
+	// also the first to expire
+	for m.order.Len() >= m.capacity {
+		m.remove(m.order.Front())
+	}
+
+	m.active[token.Unveil()] = m.order.PushBack(&nonce{
+		value:      token.Unveil(),
+		expiration: expiration,
+	})
+
 	return token
 }
 
 func (m *mint) Consume(proposal *conceal.Text) error {
+	now := m.clock()
+
 	m.lock.Lock()
 	defer m.lock.Unlock()
 
-	if !m.active.Contains(proposal) {
+	element, exists := m.active[proposal.Unveil()]
+	if !exists {
 		return ErrTokenNotValid
 	}
 
-	m.active.Remove(proposal)
+	n := m.remove(element)
+	if now.After(n.expiration) {
+		return ErrTokenExpired
+	}
+
 	return nil
 }
+
+// remove element from the active nonces; the lock must be held
+func (m *mint) remove(element *list.Element) *nonce {
+	n := m.order.Remove(element).(*nonce)
+	delete(m.active, n.value)
+	return n
+}
@@ -2,6 +2,7 @@ package nonces
 
 import (
 	"testing"
+	"time"
 
 	"github.com/shoenig/test/must"
 )
@@ -20,3 +21,41 @@ func TestMint_normal(t *testing.T) {
 	err2 := m.Consume(token)
 	must.ErrorIs(t, err2, ErrTokenNotValid)
 }
+
+func TestMint_expired(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	m := New(SetTTL(1 * time.Minute)).(*mint)
+	m.clock = func() time.Time { return now }
+
+	token := m.Create()
+	now = now.Add(2 * time.Minute)
+
+	err := m.Consume(token)
+	must.ErrorIs(t, err, ErrTokenExpired)
+
+	// expired nonces are still consumed
+	err2 := m.Consume(token)
+	must.ErrorIs(t, err2, ErrTokenNotValid)
+	must.MapEmpty(t, m.active)
+}
+
+func TestMint_capacity(t *testing.T) {
+	t.Parallel()
+
+	m := New(SetCapacity(3)).(*mint)
+
+	first := m.Create()
+	second := m.Create()
+	for range 100 {
+		_ = m.Create()
+	}
+
+	must.MapLen(t, 3, m.active)
+	must.Eq(t, 3, m.order.Len())
+
+	// the oldest nonces were discarded
+	must.ErrorIs(t, m.Consume(first), ErrTokenNotValid)
+	must.ErrorIs(t, m.Consume(second), ErrTokenNotValid)
+}
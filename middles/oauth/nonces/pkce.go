@@ -0,0 +1,28 @@
+package nonces
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+
+	"github.com/shoenig/go-conceal"
+)
+
+// ChallengeMethod is the PKCE code_challenge_method used by NewPKCE.
+const ChallengeMethod = "S256"
+
+// NewPKCE creates a PKCE (RFC 7636) code_verifier, and its S256
+// code_challenge. The challenge is sent along with the authorization request,
+// and the verifier along with the token exchange.
+func NewPKCE() (*conceal.Text, string) {
+	b := make([]byte, 32)
+	_, _ = rand.Read(b)
+	verifier := base64.RawURLEncoding.EncodeToString(b)
+	return conceal.New(verifier), challenge(verifier)
+}
+
+// challenge returns the S256 code_challenge of verifier
+func challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
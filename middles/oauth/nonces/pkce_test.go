@@ -0,0 +1,28 @@
+package nonces
+
+import (
+	"testing"
+
+	"github.com/shoenig/test/must"
+)
+
+func TestNewPKCE(t *testing.T) {
+	t.Parallel()
+
+	verifier, challenge1 := NewPKCE()
+
+	// verifier is 43 characters, the minimum length allowed
+	must.Eq(t, 43, len(verifier.Unveil()))
+	must.Eq(t, challenge(verifier.Unveil()), challenge1)
+
+	verifier2, _ := NewPKCE()
+	must.NotEq(t, verifier.Unveil(), verifier2.Unveil())
+}
+
+func Test_challenge(t *testing.T) {
+	t.Parallel()
+
+	// example from RFC 7636 appendix B
+	result := challenge("dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk")
+	must.Eq(t, "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM", result)
+}
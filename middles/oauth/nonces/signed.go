@@ -0,0 +1,113 @@
+package nonces
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	"cattlecloud.net/go/scope"
+	"cattlecloud.net/go/webtools/middles/oauth"
+	"github.com/shoenig/go-conceal"
+)
+
+const (
+	signedRandomSize = 16
+	signedExpirySize = 8
+	signedSize       = signedRandomSize + signedExpirySize + sha256.Size
+)
+
+// NewSigned creates a Mint whose nonces are tokens carrying a random value and
+// an expiration, signed using key. Any process configured with the same key can
+// consume a nonce created by any other, without sharing state.
+//
+// Consumed nonces are recorded in replay until they expire, preventing the
+// same nonce from being consumed twice. The replay cache must implement
+// oauth.Adder, such that of concurrent attempts to consume a nonce exactly one
+// succeeds; otherwise Consume returns oauth.ErrNotSupported. The replay cache
+// must be shared among processes (e.g. memcached, redis, etc.) to prevent
+// replay across processes.
+//
+// The capacity option does not apply to signed nonces.
+func NewSigned(key *conceal.Bytes, replay oauth.Cache[string, bool], opts ...OptionFunc) Mint {
+	options := &Options{
+		ttl:   10 * time.Minute,
+		clock: time.Now,
+	}
+
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	return &signed{
+		key:    key,
+		replay: replay,
+		ttl:    options.ttl,
+		clock:  options.clock,
+	}
+}
+
+type signed struct {
+	key    *conceal.Bytes
+	replay oauth.Cache[string, bool]
+	ttl    time.Duration
+	clock  func() time.Time
+}
+
+func (s *signed) Create() *conceal.Text {
+	expiration := s.clock().Add(s.ttl)
+
+	token := make([]byte, signedRandomSize+signedExpirySize, signedSize)
+	_, _ = rand.Read(token[:signedRandomSize])
+	binary.BigEndian.PutUint64(token[signedRandomSize:], uint64(expiration.UnixMilli()))
+	token = append(token, s.sign(token)...)
+
+	return conceal.New(base64.RawURLEncoding.EncodeToString(token))
+}
+
+func (s *signed) Consume(proposal *conceal.Text) error {
+	now := s.clock()
+
+	token, err := base64.RawURLEncoding.DecodeString(proposal.Unveil())
+	if err != nil || len(token) != signedSize {
+		return ErrTokenNotValid
+	}
+
+	payload, mac := token[:signedRandomSize+signedExpirySize], token[signedRandomSize+signedExpirySize:]
+	if !hmac.Equal(mac, s.sign(payload)) {
+		return ErrTokenNotValid
+	}
+
+	millis := binary.BigEndian.Uint64(payload[signedRandomSize:])
+	expiration := time.UnixMilli(int64(millis))
+	if now.After(expiration) {
+		return ErrTokenExpired
+	}
+
+	ctx, cancel := scope.TTL(10 * time.Second)
+	defer cancel()
+
+	// the random value identifies the nonce in the replay cache
+	id := base64.RawURLEncoding.EncodeToString(payload[:signedRandomSize])
+
+	// remember the nonce only for as long as it would otherwise be valid; the
+	// nonce was already consumed if it cannot be added
+	added, err := oauth.Add(ctx, s.replay, id, true, expiration.Sub(now))
+	switch {
+	case err != nil:
+		return fmt.Errorf("nonces: unable to check replay cache: %w", err)
+	case !added:
+		return ErrTokenNotValid
+	}
+
+	return nil
+}
+
+func (s *signed) sign(payload []byte) []byte {
+	h := hmac.New(sha256.New, s.key.Unveil())
+	_, _ = h.Write(payload)
+	return h.Sum(nil)
+}
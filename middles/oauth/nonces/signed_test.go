@@ -0,0 +1,199 @@
+package nonces
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"cattlecloud.net/go/webtools/middles/oauth"
+	"cattlecloud.net/go/webtools/middles/oauth/expvarsink"
+	"github.com/shoenig/go-conceal"
+	"github.com/shoenig/test/must"
+)
+
+var testKey = conceal.NewBytes([]byte("0123456789abcdef0123456789abcdef"))
+
+func TestSigned_normal(t *testing.T) {
+	t.Parallel()
+
+	replay := oauth.NewVolatileCache[bool](100)
+	m := NewSigned(testKey, replay)
+
+	token := m.Create()
+
+	err := m.Consume(token)
+	must.NoError(t, err)
+
+	err2 := m.Consume(token)
+	must.ErrorIs(t, err2, ErrTokenNotValid)
+	must.Eq(t, 1, replay.Len())
+}
+
+func TestSigned_replicas(t *testing.T) {
+	t.Parallel()
+
+	// replicas share only the key and the replay cache
+	replay := oauth.NewVolatileCache[bool](100)
+	a := NewSigned(testKey, replay)
+	b := NewSigned(testKey, replay)
+
+	token := a.Create()
+	must.NoError(t, b.Consume(token))
+	must.ErrorIs(t, a.Consume(token), ErrTokenNotValid)
+}
+
+// slowReplay adds latency to each operation, as would a remote cache
+type slowReplay struct {
+	*oauth.VolatileCache[bool]
+}
+
+func (r slowReplay) Get(key string) (bool, bool) {
+	time.Sleep(5 * time.Millisecond)
+	return r.VolatileCache.Get(key)
+}
+
+func (r slowReplay) Add(ctx context.Context, key string, value bool, ttl time.Duration) (bool, error) {
+	time.Sleep(5 * time.Millisecond)
+	return r.VolatileCache.Add(ctx, key, value, ttl)
+}
+
+func TestSigned_concurrent(t *testing.T) {
+	t.Parallel()
+
+	replays := map[string]oauth.Cache[string, bool]{
+		"volatile":     oauth.NewVolatileCache[bool](100),
+		"sharded":      oauth.NewShardedCache[bool](4, 100),
+		"instrumented": oauth.Instrument("replay", oauth.NewVolatileCache[bool](100), expvarsink.New("nonces_test")),
+		"slow":         slowReplay{oauth.NewVolatileCache[bool](100)},
+	}
+
+	for name, replay := range replays {
+		t.Run(name, func(t *testing.T) {
+			// replicas share only the key and the replay cache
+			replicas := []Mint{NewSigned(testKey, replay), NewSigned(testKey, replay)}
+			token := replicas[0].Create()
+
+			var (
+				wg        sync.WaitGroup
+				succeeded atomic.Int32
+				rejected  atomic.Int32
+			)
+
+			for i := range 20 {
+				wg.Go(func() {
+					err := replicas[i%len(replicas)].Consume(token)
+					switch {
+					case err == nil:
+						succeeded.Add(1)
+					case errors.Is(err, ErrTokenNotValid):
+						rejected.Add(1)
+					}
+				})
+			}
+			wg.Wait()
+
+			must.Eq(t, 1, succeeded.Load())
+			must.Eq(t, 19, rejected.Load())
+		})
+	}
+}
+
+func TestSigned_expired(t *testing.T) {
+	t.Parallel()
+
+	replay := oauth.NewVolatileCache[bool](100)
+	m := NewSigned(testKey, replay, SetTTL(1*time.Minute)).(*signed)
+
+	now := time.Now()
+	m.clock = func() time.Time { return now }
+	token := m.Create()
+
+	now = now.Add(2 * time.Minute)
+	err := m.Consume(token)
+	must.ErrorIs(t, err, ErrTokenExpired)
+	must.Eq(t, 0, replay.Len())
+}
+
+func TestSigned_notValid(t *testing.T) {
+	t.Parallel()
+
+	replay := oauth.NewVolatileCache[bool](100)
+	m := NewSigned(testKey, replay)
+	token := m.Create().Unveil()
+
+	other := NewSigned(conceal.NewBytes([]byte("another key")), replay)
+
+	cases := []struct {
+		name     string
+		proposal string
+	}{
+		{name: "empty", proposal: ""},
+		{name: "garbage", proposal: "not a token"},
+		{name: "truncated", proposal: token[:len(token)-2]},
+		{name: "tampered", proposal: tamper(token)},
+		{name: "other key", proposal: other.Create().Unveil()},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := m.Consume(conceal.New(tc.proposal))
+			must.ErrorIs(t, err, ErrTokenNotValid)
+		})
+	}
+}
+
+// brokenReplay fails every operation
+type brokenReplay struct{}
+
+func (brokenReplay) Get(string) (bool, bool)         { return false, false }
+func (brokenReplay) Put(string, bool, time.Duration) {}
+
+func (brokenReplay) GetContext(context.Context, string) (bool, bool, error) {
+	return false, false, errors.New("unavailable")
+}
+
+func (brokenReplay) PutContext(context.Context, string, bool, time.Duration) error {
+	return errors.New("unavailable")
+}
+
+func (brokenReplay) DeleteContext(context.Context, string) error {
+	return errors.New("unavailable")
+}
+
+func (brokenReplay) Add(context.Context, string, bool, time.Duration) (bool, error) {
+	return false, errors.New("unavailable")
+}
+
+func TestSigned_replayFailure(t *testing.T) {
+	t.Parallel()
+
+	m := NewSigned(testKey, brokenReplay{})
+	err := m.Consume(m.Create())
+	must.ErrorContains(t, err, "unable to check replay cache")
+}
+
+// plainReplay does not implement oauth.Adder
+type plainReplay struct {
+	oauth.Cache[string, bool]
+}
+
+func TestSigned_replayNotSupported(t *testing.T) {
+	t.Parallel()
+
+	m := NewSigned(testKey, plainReplay{oauth.NewVolatileCache[bool](100)})
+	err := m.Consume(m.Create())
+	must.ErrorIs(t, err, oauth.ErrNotSupported)
+}
+
+// tamper replaces the first character of token
+func tamper(token string) string {
+	first := "A"
+	if strings.HasPrefix(token, first) {
+		first = "B"
+	}
+	return first + token[1:]
+}
@@ -0,0 +1,276 @@
+package nonces
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"unicode"
+
+	"cattlecloud.net/go/scope"
+	"cattlecloud.net/go/webtools/middles/oauth"
+	"github.com/shoenig/go-conceal"
+)
+
+var (
+	ErrStateNotValid    = errors.New("state not valid")
+	ErrReturnNotValid   = errors.New("return url not valid")
+	ErrVerifierNotFound = errors.New("pkce verifier not found")
+)
+
+// DefaultStateCookieName is the name of the cookie binding the state to the
+// browser if States.Name is not set.
+const DefaultStateCookieName = "oauth_state"
+
+// States manages the OAuth state parameter, binding each login to the browser
+// which started it by way of a short-lived cookie. This prevents login-CSRF,
+// where an attacker tricks a victim into completing the attacker's login.
+//
+// Each browser may have only one login in progress; starting another login
+// replaces the previous one.
+type States struct {
+	Mint   Mint
+	Name   string
+	Secure bool
+	TTL    time.Duration // default 10 minutes
+	Clock  func() time.Time
+
+	// SameSite of the state cookie; the default is http.SameSiteLaxMode. Any
+	// provider responding by form_post (e.g. Apple) requires
+	// http.SameSiteNoneMode, along with Secure.
+	SameSite http.SameSite
+
+	// Verifiers enables PKCE (RFC 7636) if set, storing the code_verifier of
+	// each login keyed by state, until the login is completed.
+	Verifiers oauth.Cache[string, string]
+}
+
+// Login is the state of an OAuth login in progress.
+type Login struct {
+	// State is the value of the OAuth state parameter.
+	State string
+
+	// Nonce is the value of the OIDC nonce parameter, which is expected back in
+	// the nonce claim of the id_token.
+	Nonce *conceal.Text
+
+	// Provider is the name of the OAuth provider.
+	Provider string
+
+	// ReturnURL is the local path to redirect to once logged in.
+	ReturnURL string
+
+	// Challenge is the value of the PKCE code_challenge parameter, using the
+	// S256 method. Set by Begin only if PKCE is enabled.
+	Challenge string
+
+	// Verifier is the value of the PKCE code_verifier parameter, to be sent
+	// with the token exchange. Set by Complete only if PKCE is enabled.
+	Verifier *conceal.Text
+}
+
+// payload is the encoded form of a Login carried by the state parameter
+type payload struct {
+	Nonce     string `json:"n"`
+	Provider  string `json:"p"`
+	ReturnURL string `json:"r"`
+}
+
+// Begin a login with provider, setting the state cookie on w. The returned
+// Login contains the state and nonce parameters to be sent to the provider.
+//
+// The returnURL must be a local path (e.g. "/account"), or empty.
+func (s *States) Begin(w http.ResponseWriter, provider, returnURL string) (*Login, error) {
+	if !localPath(returnURL) {
+		return nil, ErrReturnNotValid
+	}
+
+	nonce := s.Mint.Create()
+
+	b, err := json.Marshal(&payload{
+		Nonce:     nonce.Unveil(),
+		Provider:  provider,
+		ReturnURL: returnURL,
+	})
+	if err != nil {
+		return nil, err
+	}
+	state := base64.RawURLEncoding.EncodeToString(b)
+
+	login := &Login{
+		State:     state,
+		Nonce:     nonce,
+		Provider:  provider,
+		ReturnURL: returnURL,
+	}
+
+	if s.Verifiers != nil {
+		ctx, cancel := scope.TTL(10 * time.Second)
+		defer cancel()
+
+		verifier, challenge := NewPKCE()
+		if err = oauth.Put(ctx, s.Verifiers, state, verifier.Unveil(), s.ttl()); err != nil {
+			return nil, fmt.Errorf("nonces: unable to store pkce verifier: %w", err)
+		}
+		login.Challenge = challenge
+	}
+
+	http.SetCookie(w, s.cookie(state, s.clock().Add(s.ttl())))
+
+	return login, nil
+}
+
+// Complete the login of r, which is the request made to the OAuth callback.
+// The state parameter of r must match the state cookie, and the nonce it
+// carries is consumed. The state cookie is cleared on w.
+//
+// If PKCE is enabled, the returned Login includes the code_verifier, which is
+// removed from Verifiers.
+func (s *States) Complete(w http.ResponseWriter, r *http.Request) (*Login, error) {
+	cookie, err := r.Cookie(s.name())
+	if err != nil || cookie.Value == "" {
+		return nil, ErrStateNotValid
+	}
+
+	// the state is only good once, whether or not it is valid
+	http.SetCookie(w, s.cookie("", time.Unix(0, 0)))
+
+	// providers respond with either a query parameter, or a form post
+	state := r.FormValue("state")
+	if subtle.ConstantTimeCompare([]byte(state), []byte(cookie.Value)) != 1 {
+		return nil, ErrStateNotValid
+	}
+
+	b, err := base64.RawURLEncoding.DecodeString(state)
+	if err != nil {
+		return nil, ErrStateNotValid
+	}
+
+	var p payload
+	if err = json.Unmarshal(b, &p); err != nil {
+		return nil, ErrStateNotValid
+	}
+
+	// the cookie may have been planted, e.g. from a sibling subdomain
+	if !localPath(p.ReturnURL) {
+		return nil, ErrReturnNotValid
+	}
+
+	nonce := conceal.New(p.Nonce)
+	if err = s.Mint.Consume(nonce); err != nil {
+		return nil, err
+	}
+
+	login := &Login{
+		State:     state,
+		Nonce:     nonce,
+		Provider:  p.Provider,
+		ReturnURL: p.ReturnURL,
+	}
+
+	if s.Verifiers != nil {
+		verifier, verr := s.verifier(r.Context(), state)
+		if verr != nil {
+			return nil, verr
+		}
+		login.Verifier = verifier
+	}
+
+	return login, nil
+}
+
+// verifier returns the PKCE code_verifier stored for state, removing it from
+// Verifiers
+func (s *States) verifier(ctx context.Context, state string) (*conceal.Text, error) {
+	verifier, exists, err := oauth.Get(ctx, s.Verifiers, state)
+	switch {
+	case err != nil:
+		return nil, fmt.Errorf("nonces: unable to get pkce verifier: %w", err)
+	case !exists:
+		return nil, ErrVerifierNotFound
+	}
+
+	// the nonce is already consumed, so removing the verifier is best effort
+	_ = oauth.Delete(ctx, s.Verifiers, state)
+
+	return conceal.New(verifier), nil
+}
+
+func (s *States) cookie(value string, expiration time.Time) *http.Cookie {
+	sameSite := s.SameSite
+	if sameSite == 0 {
+		sameSite = http.SameSiteLaxMode
+	}
+
+	cookie := &http.Cookie{
+		Name:     s.name(),
+		Value:    value,
+		Path:     "/",
+		HttpOnly: true,
+		Expires:  expiration,
+		SameSite: sameSite,
+		Secure:   s.Secure,
+	}
+
+	if value == "" {
+		cookie.MaxAge = -1
+	}
+
+	return cookie
+}
+
+func (s *States) name() string {
+	if s.Name == "" {
+		return DefaultStateCookieName
+	}
+	return s.Name
+}
+
+func (s *States) ttl() time.Duration {
+	if s.TTL <= 0 {
+		return 10 * time.Minute
+	}
+	return s.TTL
+}
+
+func (s *States) clock() time.Time {
+	if s.Clock == nil {
+		return time.Now()
+	}
+	return s.Clock()
+}
+
+// localPath returns whether u is empty or a path on the same site, rejecting
+// absolute and scheme-relative URLs which would enable an open redirect.
+//
+// Browsers strip tabs and newlines from URLs and treat \ as /, so any control
+// character, whitespace, or \ is rejected outright.
+func localPath(u string) bool {
+	if u == "" {
+		return true
+	}
+
+	if strings.ContainsFunc(u, func(r rune) bool {
+		return r == '\\' || unicode.IsSpace(r) || unicode.IsControl(r)
+	}) {
+		return false
+	}
+
+	parsed, err := url.Parse(u)
+	switch {
+	case err != nil:
+		return false
+	case parsed.Scheme != "" || parsed.Host != "":
+		return false
+	case !strings.HasPrefix(u, "/"), strings.HasPrefix(u, "//"):
+		return false
+	default:
+		return true
+	}
+}
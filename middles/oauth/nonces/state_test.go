@@ -0,0 +1,177 @@
+package nonces
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"cattlecloud.net/go/webtools/middles/oauth"
+	"github.com/shoenig/test/must"
+)
+
+func begin(t *testing.T, s *States) (*Login, *http.Cookie) {
+	t.Helper()
+
+	w := httptest.NewRecorder()
+	login, err := s.Begin(w, "google", "/account")
+	must.NoError(t, err)
+
+	cookies := w.Result().Cookies()
+	must.SliceLen(t, 1, cookies)
+	return login, cookies[0]
+}
+
+func callback(state string, cookie *http.Cookie) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, "/callback?"+url.Values{"state": {state}}.Encode(), nil)
+	if cookie != nil {
+		r.AddCookie(cookie)
+	}
+	return r
+}
+
+func TestStates_normal(t *testing.T) {
+	t.Parallel()
+
+	s := &States{Mint: New()}
+	login, cookie := begin(t, s)
+	must.Eq(t, DefaultStateCookieName, cookie.Name)
+	must.Eq(t, login.State, cookie.Value)
+	must.True(t, cookie.HttpOnly)
+	must.Eq(t, http.SameSiteLaxMode, cookie.SameSite)
+
+	w := httptest.NewRecorder()
+	result, err := s.Complete(w, callback(login.State, cookie))
+	must.NoError(t, err)
+	must.Eq(t, "google", result.Provider)
+	must.Eq(t, "/account", result.ReturnURL)
+	must.Eq(t, login.Nonce.Unveil(), result.Nonce.Unveil())
+
+	// the state cookie is cleared
+	cleared := w.Result().Cookies()
+	must.SliceLen(t, 1, cleared)
+	must.Eq(t, -1, cleared[0].MaxAge)
+
+	// the nonce is consumed
+	_, err2 := s.Complete(httptest.NewRecorder(), callback(login.State, cookie))
+	must.ErrorIs(t, err2, ErrTokenNotValid)
+}
+
+func TestStates_formPost(t *testing.T) {
+	t.Parallel()
+
+	s := &States{Mint: New(), Secure: true, SameSite: http.SameSiteNoneMode}
+	login, cookie := begin(t, s)
+	must.Eq(t, http.SameSiteNoneMode, cookie.SameSite)
+
+	form := url.Values{"state": {login.State}}
+	r := httptest.NewRequest(http.MethodPost, "/callback", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.AddCookie(cookie)
+
+	result, err := s.Complete(httptest.NewRecorder(), r)
+	must.NoError(t, err)
+	must.Eq(t, "google", result.Provider)
+}
+
+func TestStates_notValid(t *testing.T) {
+	t.Parallel()
+
+	s := &States{Mint: New()}
+
+	t.Run("no cookie", func(t *testing.T) {
+		login, _ := begin(t, s)
+		_, err := s.Complete(httptest.NewRecorder(), callback(login.State, nil))
+		must.ErrorIs(t, err, ErrStateNotValid)
+	})
+
+	t.Run("other browser", func(t *testing.T) {
+		// the attacker's state completed in the victim's browser
+		attacker, _ := begin(t, s)
+		_, victim := begin(t, s)
+		_, err := s.Complete(httptest.NewRecorder(), callback(attacker.State, victim))
+		must.ErrorIs(t, err, ErrStateNotValid)
+	})
+
+	t.Run("missing state", func(t *testing.T) {
+		_, cookie := begin(t, s)
+		_, err := s.Complete(httptest.NewRecorder(), callback("", cookie))
+		must.ErrorIs(t, err, ErrStateNotValid)
+	})
+
+	t.Run("planted return", func(t *testing.T) {
+		// a state cookie planted from a sibling subdomain
+		b, _ := json.Marshal(&payload{Nonce: s.Mint.Create().Unveil(), Provider: "google", ReturnURL: "/\t/evil.example.com"})
+		state := base64.RawURLEncoding.EncodeToString(b)
+		cookie := &http.Cookie{Name: DefaultStateCookieName, Value: state}
+		_, err := s.Complete(httptest.NewRecorder(), callback(state, cookie))
+		must.ErrorIs(t, err, ErrReturnNotValid)
+	})
+
+	t.Run("garbage", func(t *testing.T) {
+		cookie := &http.Cookie{Name: DefaultStateCookieName, Value: "not%state"}
+		_, err := s.Complete(httptest.NewRecorder(), callback("not%state", cookie))
+		must.ErrorIs(t, err, ErrStateNotValid)
+	})
+}
+
+func TestStates_returnURL(t *testing.T) {
+	t.Parallel()
+
+	s := &States{Mint: New()}
+
+	cases := []struct {
+		returnURL string
+		exp       error
+	}{
+		{returnURL: "", exp: nil},
+		{returnURL: "/", exp: nil},
+		{returnURL: "/account?tab=1", exp: nil},
+		{returnURL: "https://evil.example.com", exp: ErrReturnNotValid},
+		{returnURL: "//evil.example.com", exp: ErrReturnNotValid},
+		{returnURL: "/\\evil.example.com", exp: ErrReturnNotValid},
+		{returnURL: "/account\\..\\\\evil.example.com", exp: ErrReturnNotValid},
+		{returnURL: "/\t/evil.example.com", exp: ErrReturnNotValid},
+		{returnURL: "/\n/evil.example.com", exp: ErrReturnNotValid},
+		{returnURL: "/\r/evil.example.com", exp: ErrReturnNotValid},
+		{returnURL: "/ /evil.example.com", exp: ErrReturnNotValid},
+		{returnURL: "/\x00/evil.example.com", exp: ErrReturnNotValid},
+		{returnURL: "account", exp: ErrReturnNotValid},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.returnURL, func(t *testing.T) {
+			_, err := s.Begin(httptest.NewRecorder(), "google", tc.returnURL)
+			must.ErrorIs(t, err, tc.exp)
+		})
+	}
+}
+
+func TestStates_pkce(t *testing.T) {
+	t.Parallel()
+
+	verifiers := oauth.NewVolatileCache[string](100)
+	s := &States{Mint: New(), Verifiers: verifiers}
+
+	login, cookie := begin(t, s)
+	must.Eq(t, 43, len(login.Challenge))
+	must.Nil(t, login.Verifier)
+	must.Eq(t, 1, verifiers.Len())
+
+	result, err := s.Complete(httptest.NewRecorder(), callback(login.State, cookie))
+	must.NoError(t, err)
+	must.Eq(t, login.Challenge, challenge(result.Verifier.Unveil()))
+
+	// the verifier is removed once handed back
+	must.Eq(t, 0, verifiers.Len())
+
+	t.Run("missing", func(t *testing.T) {
+		login2, cookie2 := begin(t, s)
+		verifiers.Delete(login2.State)
+		_, err2 := s.Complete(httptest.NewRecorder(), callback(login2.State, cookie2))
+		must.ErrorIs(t, err2, ErrVerifierNotFound)
+	})
+}
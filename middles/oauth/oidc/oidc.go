@@ -0,0 +1,250 @@
+// Package oidc provides a Validator of id tokens issued by any OpenID Connect
+// provider, configured by way of the provider's discovery document.
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"cattlecloud.net/go/scope"
+	"cattlecloud.net/go/webtools/middles/oauth"
+	"cattlecloud.net/go/webtools/middles/oauth/jwks"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// discovery is the path of the discovery document, relative to the issuer
+	discovery = "/.well-known/openid-configuration"
+
+	// retry is how long the last good discovery document is used after the
+	// discovery document could not be read again
+	retry = 1 * time.Minute
+)
+
+type Claims struct {
+	// JWT standard types (scope: oidc)
+	jwt.RegisteredClaims
+	Nonce string `json:"nonce"`
+
+	// OIDC standard types (scope: email)
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+}
+
+// GetNonce returns the nonce claim, which must match the nonce sent with the
+// authorization request.
+func (c *Claims) GetNonce() string {
+	return c.Nonce
+}
+
+type Options struct {
+	issuer     string
+	cache      oauth.Cache[string, crypto.PublicKey]
+	httpClient *http.Client
+	clientID   string
+	refresh    time.Duration
+}
+
+type OptionFunc func(*Options)
+
+func SetHTTP(client *http.Client) OptionFunc {
+	return func(o *Options) { o.httpClient = client }
+}
+
+func SetClientID(id string) OptionFunc {
+	return func(o *Options) { o.clientID = id }
+}
+
+// SetIssuer sets the issuer identifier of the provider, e.g.
+// https://accounts.google.com, from which the discovery document is read.
+//
+// The issuer must be exactly the issuer of the discovery document and tokens,
+// including any trailing slash, e.g. https://example.auth0.com/.
+func SetIssuer(issuer string) OptionFunc {
+	return func(o *Options) { o.issuer = issuer }
+}
+
+func SetCache(c oauth.Cache[string, crypto.PublicKey]) OptionFunc {
+	return func(o *Options) { o.cache = c }
+}
+
+// SetRefresh sets how often the discovery document is read again. The default
+// is 24 hours. If the discovery document cannot be read again, the last good
+// discovery document continues to be used.
+func SetRefresh(refresh time.Duration) OptionFunc {
+	return func(o *Options) { o.refresh = refresh }
+}
+
+func New(opts ...OptionFunc) Validator {
+	options := &Options{
+		cache:      oauth.NewVolatileCache[crypto.PublicKey](16),
+		httpClient: &http.Client{Timeout: 1 * time.Minute},
+		refresh:    24 * time.Hour,
+	}
+
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	return &validator{
+		cache:   options.cache,
+		dc:      oauth.NewLoadingCache[*configuration](oauth.NewVolatileCache[*configuration](1)),
+		hc:      options.httpClient,
+		id:      options.clientID,
+		issuer:  options.issuer,
+		refresh: options.refresh,
+		keySets: make(map[string]*jwks.KeySet),
+	}
+}
+
+type Validator interface {
+	Validate(string) (*Claims, error)
+}
+
+type validator struct {
+	cache   oauth.Cache[string, crypto.PublicKey]
+	dc      *oauth.LoadingCache[*configuration]
+	hc      *http.Client
+	id      string
+	issuer  string
+	refresh time.Duration
+
+	lock    sync.Mutex
+	last    *configuration          // last good discovery document
+	keySets map[string]*jwks.KeySet // by jwks_uri
+}
+
+// configuration is the subset of the discovery document used for validation
+type configuration struct {
+	Issuer     string   `json:"issuer"`
+	JWKSURI    string   `json:"jwks_uri"`
+	Algorithms []string `json:"id_token_signing_alg_values_supported"`
+
+	keys *jwks.KeySet // of the JWKSURI
+}
+
+func (v *validator) Validate(token string) (*Claims, error) {
+	ctx, cancel := scope.TTL(30 * time.Second)
+	defer cancel()
+
+	config, err := v.getConfiguration(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	claims := new(Claims)
+
+	// parse the token into claims object, restricted to the algorithms the
+	// provider says it uses, and checking the standard claims
+	_, err = jwt.ParseWithClaims(
+		token,
+		claims,
+		func(t *jwt.Token) (any, error) {
+			keyID := fmt.Sprintf("%s", t.Header["kid"])
+			return config.keys.Key(ctx, keyID)
+		},
+		jwt.WithValidMethods(config.algorithms()),
+		jwt.WithIssuer(config.Issuer),
+		jwt.WithAudience(v.id),
+		jwt.WithExpirationRequired(),
+	)
+
+	// unable to get token or parse it
+	if err != nil {
+		return nil, fmt.Errorf("oauth/oidc: unable to parse JWT: %w", err)
+	}
+
+	return claims, nil
+}
+
+// algorithms returns the signing algorithms of the provider, excluding none;
+// providers which do not say must support RS256
+func (c *configuration) algorithms() []string {
+	algorithms := make([]string, 0, len(c.Algorithms))
+	for _, alg := range c.Algorithms {
+		if alg != "none" {
+			algorithms = append(algorithms, alg)
+		}
+	}
+	if len(algorithms) == 0 {
+		return []string{"RS256"}
+	}
+	return algorithms
+}
+
+func (v *validator) getConfiguration(ctx context.Context) (*configuration, error) {
+	return v.dc.GetOrLoad(ctx, v.issuer, func(ctx context.Context) (*configuration, time.Duration, error) {
+		config, ttl, err := v.fetchConfiguration(ctx)
+
+		v.lock.Lock()
+		defer v.lock.Unlock()
+
+		switch {
+		case err == nil:
+			v.last = config
+			return config, ttl, nil
+		case v.last != nil:
+			// keep using the last good discovery document, trying again soon
+			return v.last, min(retry, v.refresh), nil
+		default:
+			return nil, 0, err
+		}
+	})
+}
+
+func (v *validator) fetchConfiguration(ctx context.Context) (*configuration, time.Duration, error) {
+	if v.issuer == "" {
+		return nil, 0, errors.New("oauth/oidc: issuer not set")
+	}
+
+	request, _ := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(v.issuer, "/")+discovery, nil)
+	response, err := v.hc.Do(request)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer func() { _ = response.Body.Close() }()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, 0, fmt.Errorf("oauth/oidc: unexpected discovery status %d", response.StatusCode)
+	}
+
+	config := new(configuration)
+	if err = json.NewDecoder(response.Body).Decode(config); err != nil {
+		return nil, 0, err
+	}
+
+	// the issuer of the document must be exactly the issuer it was read from
+	if config.Issuer != v.issuer {
+		return nil, 0, errors.New("oauth/oidc: discovery issuer not valid")
+	}
+
+	if config.JWKSURI == "" {
+		return nil, 0, errors.New("oauth/oidc: discovery jwks_uri not set")
+	}
+
+	config.keys = v.keySet(config.JWKSURI)
+
+	return config, v.refresh, nil
+}
+
+// keySet returns the KeySet of uri, which is kept across refreshes of the
+// discovery document so that the rate limit and stale keys of its fetcher are
+// not lost
+func (v *validator) keySet(uri string) *jwks.KeySet {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	ks, exists := v.keySets[uri]
+	if !exists {
+		ks = jwks.New(uri, jwks.SetHTTP(v.hc), jwks.SetCache(v.cache))
+		v.keySets[uri] = ks
+	}
+	return ks
+}
@@ -0,0 +1,299 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/shoenig/test/must"
+)
+
+const clientID = "test-case-client"
+
+// provider is a fake OIDC provider serving a discovery document and keys
+type provider struct {
+	server     *httptest.Server
+	issuer     string // as written in the discovery document
+	algorithms []string
+	keys       []map[string]string
+	discovered atomic.Int32
+	fetched    atomic.Int32
+	down       atomic.Bool // discovery document not available
+}
+
+func newProvider(t *testing.T) *provider {
+	p := new(provider)
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET "+discovery, func(w http.ResponseWriter, _ *http.Request) {
+		p.discovered.Add(1)
+		if p.down.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"issuer":                                p.issuer,
+			"jwks_uri":                              p.server.URL + "/keys",
+			"id_token_signing_alg_values_supported": p.algorithms,
+		})
+	})
+	mux.HandleFunc("GET /keys", func(w http.ResponseWriter, _ *http.Request) {
+		p.fetched.Add(1)
+		_ = json.NewEncoder(w).Encode(map[string]any{"keys": p.keys})
+	})
+	p.server = httptest.NewServer(mux)
+	p.issuer = p.server.URL
+	p.algorithms = []string{"RS256", "ES256"}
+	t.Cleanup(p.server.Close)
+	return p
+}
+
+func (p *provider) validator(opts ...OptionFunc) Validator {
+	return New(append([]OptionFunc{
+		SetHTTP(p.server.Client()),
+		SetClientID(clientID),
+		SetIssuer(p.server.URL),
+	}, opts...)...)
+}
+
+func encode(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func rsaKey(t *testing.T, kid string) (*rsa.PrivateKey, map[string]string) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	must.NoError(t, err)
+	return key, map[string]string{
+		"kid": kid,
+		"kty": "RSA",
+		"use": "sig",
+		"n":   encode(key.N.Bytes()),
+		"e":   encode(big.NewInt(int64(key.E)).Bytes()),
+	}
+}
+
+func ecKey(t *testing.T, kid string) (*ecdsa.PrivateKey, map[string]string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	must.NoError(t, err)
+	point, err := key.PublicKey.Bytes()
+	must.NoError(t, err)
+	return key, map[string]string{
+		"kid": kid,
+		"kty": "EC",
+		"crv": "P-256",
+		"x":   encode(point[1:33]),
+		"y":   encode(point[33:]),
+	}
+}
+
+func (p *provider) claims() *Claims {
+	now := time.Now()
+	return &Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    p.issuer,
+			Audience:  jwt.ClaimStrings{clientID},
+			ExpiresAt: jwt.NewNumericDate(now.Add(1 * time.Hour)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			Subject:   "1234567890",
+		},
+		Nonce: "nonce-1",
+		Email: "tester@example.com",
+	}
+}
+
+func sign(t *testing.T, method jwt.SigningMethod, kid string, key crypto.Signer, claims *Claims) string {
+	token := jwt.NewWithClaims(method, claims)
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(key)
+	must.NoError(t, err)
+	return signed
+}
+
+func TestValidator_Validate(t *testing.T) {
+	t.Parallel()
+
+	p := newProvider(t)
+	rsaPrivate, rsaPublic := rsaKey(t, "rsa-1")
+	ecPrivate, ecPublic := ecKey(t, "ec-1")
+	p.keys = []map[string]string{
+		rsaPublic,
+		ecPublic,
+		{"kid": "enc-1", "kty": "RSA", "use": "enc"},
+		{"kid": "okp-1", "kty": "unknown"},
+	}
+	v := p.validator()
+
+	t.Run("rsa", func(t *testing.T) {
+		claims, err := v.Validate(sign(t, jwt.SigningMethodRS256, "rsa-1", rsaPrivate, p.claims()))
+		must.NoError(t, err)
+		must.Eq(t, "tester@example.com", claims.Email)
+		must.Eq(t, "nonce-1", claims.GetNonce())
+	})
+
+	t.Run("ec", func(t *testing.T) {
+		claims, err := v.Validate(sign(t, jwt.SigningMethodES256, "ec-1", ecPrivate, p.claims()))
+		must.NoError(t, err)
+		must.Eq(t, "1234567890", claims.Subject)
+	})
+
+	// the discovery document and keys were each fetched once
+	must.Eq(t, 1, p.discovered.Load())
+	must.Eq(t, 1, p.fetched.Load())
+}
+
+func TestValidator_Validate_notValid(t *testing.T) {
+	t.Parallel()
+
+	p := newProvider(t)
+	p.algorithms = []string{"RS256"}
+	rsaPrivate, rsaPublic := rsaKey(t, "rsa-1")
+	ecPrivate, ecPublic := ecKey(t, "ec-1")
+	p.keys = []map[string]string{rsaPublic, ecPublic}
+	v := p.validator()
+
+	cases := []struct {
+		name   string
+		token  func() string
+		reason string
+	}{
+		{
+			name: "algorithm not supported",
+			token: func() string {
+				return sign(t, jwt.SigningMethodES256, "ec-1", ecPrivate, p.claims())
+			},
+			reason: "signing method ES256 is invalid",
+		},
+		{
+			name: "issuer",
+			token: func() string {
+				claims := p.claims()
+				claims.Issuer = "https://evil.example.com"
+				return sign(t, jwt.SigningMethodRS256, "rsa-1", rsaPrivate, claims)
+			},
+			reason: "token has invalid issuer",
+		},
+		{
+			name: "audience",
+			token: func() string {
+				claims := p.claims()
+				claims.Audience = jwt.ClaimStrings{"another-client"}
+				return sign(t, jwt.SigningMethodRS256, "rsa-1", rsaPrivate, claims)
+			},
+			reason: "token has invalid audience",
+		},
+		{
+			name: "expired",
+			token: func() string {
+				claims := p.claims()
+				claims.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-1 * time.Hour))
+				return sign(t, jwt.SigningMethodRS256, "rsa-1", rsaPrivate, claims)
+			},
+			reason: "token is expired",
+		},
+		{
+			name: "unknown key",
+			token: func() string {
+				return sign(t, jwt.SigningMethodRS256, "rsa-2", rsaPrivate, p.claims())
+			},
+			// the keys were fetched by the cases above
+			reason: `key "rsa-2" rejected without fetch`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := v.Validate(tc.token())
+			must.ErrorContains(t, err, tc.reason)
+		})
+	}
+}
+
+func TestValidator_Validate_discovery(t *testing.T) {
+	t.Parallel()
+
+	p := newProvider(t)
+	private, public := rsaKey(t, "rsa-1")
+	p.keys = []map[string]string{public}
+
+	// the discovery document claims to be of another issuer
+	p.issuer = "https://evil.example.com"
+	v := p.validator()
+
+	_, err := v.Validate(sign(t, jwt.SigningMethodRS256, "rsa-1", private, p.claims()))
+	must.ErrorContains(t, err, "discovery issuer not valid")
+
+	t.Run("issuer not set", func(t *testing.T) {
+		v2 := New(SetHTTP(p.server.Client()), SetClientID(clientID))
+		_, err2 := v2.Validate(sign(t, jwt.SigningMethodRS256, "rsa-1", private, p.claims()))
+		must.ErrorContains(t, err2, "issuer not set")
+	})
+}
+
+func TestValidator_Validate_trailingSlash(t *testing.T) {
+	t.Parallel()
+
+	p := newProvider(t)
+	private, public := rsaKey(t, "rsa-1")
+	p.keys = []map[string]string{public}
+
+	// e.g. auth0, whose issuer ends in a slash
+	p.issuer = p.server.URL + "/"
+
+	t.Run("configured", func(t *testing.T) {
+		v := p.validator(SetIssuer(p.server.URL + "/"))
+		claims, err := v.Validate(sign(t, jwt.SigningMethodRS256, "rsa-1", private, p.claims()))
+		must.NoError(t, err)
+		must.Eq(t, p.server.URL+"/", claims.Issuer)
+	})
+
+	t.Run("not configured", func(t *testing.T) {
+		v := p.validator()
+		_, err := v.Validate(sign(t, jwt.SigningMethodRS256, "rsa-1", private, p.claims()))
+		must.ErrorContains(t, err, "discovery issuer not valid")
+	})
+}
+
+func TestValidator_Validate_refresh(t *testing.T) {
+	t.Parallel()
+
+	p := newProvider(t)
+	private, public := rsaKey(t, "rsa-1")
+	p.keys = []map[string]string{public}
+	v := p.validator(SetRefresh(1 * time.Millisecond)).(*validator)
+
+	config1, err := v.getConfiguration(context.Background())
+	must.NoError(t, err)
+
+	// the discovery document is read again, keeping the same fetcher
+	time.Sleep(5 * time.Millisecond)
+	config2, err := v.getConfiguration(context.Background())
+	must.NoError(t, err)
+	must.Eq(t, 2, p.discovered.Load())
+	must.True(t, config1 != config2)
+	must.True(t, config1.keys == config2.keys)
+
+	// the discovery document cannot be read again, the last good one is used
+	p.down.Store(true)
+	time.Sleep(5 * time.Millisecond)
+	_, err = v.Validate(sign(t, jwt.SigningMethodRS256, "rsa-1", private, p.claims()))
+	must.NoError(t, err)
+	must.Eq(t, 3, p.discovered.Load())
+	must.Eq(t, 1, p.fetched.Load())
+
+	t.Run("never read", func(t *testing.T) {
+		v2 := p.validator()
+		_, err2 := v2.Validate(sign(t, jwt.SigningMethodRS256, "rsa-1", private, p.claims()))
+		must.ErrorContains(t, err2, "unexpected discovery status 503")
+	})
+}
@@ -0,0 +1,203 @@
+package oauth
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+)
+
+// SnapshotEvery sets the interval at which a PersistentCache writes a snapshot
+// of its items to disk. The default interval is one minute.
+//
+// SnapshotEvery has no effect on a plain VolatileCache.
+func SnapshotEvery(interval time.Duration) VolatileOption {
+	return func(o *volatileOptions) { o.snapshot = interval }
+}
+
+// NewPersistentCache creates a PersistentCache which periodically writes the
+// items of the cache to the file at path, using codec to encode each value.
+//
+// Any items previously written to path are loaded into the cache, excluding
+// items which have since expired.
+func NewPersistentCache[T any](path string, size int, codec Codec[T], opts ...VolatileOption) (*PersistentCache[T], error) {
+	return newPersistentCache(path, size, codec, newVolatileOptions(opts))
+}
+
+func newPersistentCache[T any](path string, size int, codec Codec[T], options *volatileOptions) (*PersistentCache[T], error) {
+	pc := &PersistentCache[T]{
+		VolatileCache: newVolatileCache[T](size, options),
+		path:          path,
+		codec:         codec,
+		lock:          new(sync.Mutex),
+		stop:          make(chan struct{}),
+		done:          make(chan struct{}),
+	}
+
+	if err := pc.load(); err != nil {
+		_ = pc.VolatileCache.Close()
+		return nil, err
+	}
+
+	if options.snapshot > 0 {
+		ticks, cancel := options.ticker(options.snapshot)
+		go pc.snapshots(ticks, cancel)
+	} else {
+		close(pc.done)
+	}
+
+	return pc, nil
+}
+
+// PersistentCache is an in-memory implementation of Cache which survives
+// process restarts, by periodically writing a snapshot of its unexpired items
+// to a local file.
+//
+// Items written since the most recent snapshot are lost if the process exits
+// without calling Close.
+//
+// This implementation is suitable for services running as a single process;
+// services running as many processes should make use of memcached, redis, etc.
+type PersistentCache[T any] struct {
+	*VolatileCache[T]
+
+	path  string
+	codec Codec[T]
+	lock  *sync.Mutex // serializes snapshots
+
+	once sync.Once
+	stop chan struct{}
+	done chan struct{}
+}
+
+// snapshot is the on-disk format of a PersistentCache
+type snapshot struct {
+	Items []*snapshotItem `json:"items"`
+}
+
+type snapshotItem struct {
+	Key        string    `json:"key"`
+	Value      []byte    `json:"value"`
+	Expiration time.Time `json:"expiration"`
+}
+
+// Snapshot writes the unexpired items of the cache to disk. The file is
+// replaced atomically, such that a partially written snapshot is never read.
+func (pc *PersistentCache[T]) Snapshot() error {
+	// items are read while holding the lock, so that a snapshot taken earlier
+	// never replaces one taken later
+	pc.lock.Lock()
+	defer pc.lock.Unlock()
+
+	items := pc.live()
+
+	s := &snapshot{Items: make([]*snapshotItem, 0, len(items))}
+	for _, item := range items {
+		b, err := pc.codec.Encode(item.value)
+		if err != nil {
+			return fmt.Errorf("cache: unable to encode value: %w", err)
+		}
+		s.Items = append(s.Items, &snapshotItem{
+			Key:        item.key,
+			Value:      b,
+			Expiration: item.expiration,
+		})
+	}
+
+	b, err := json.Marshal(s)
+	if err != nil {
+		return fmt.Errorf("cache: unable to encode snapshot: %w", err)
+	}
+
+	return writeAtomic(pc.path, b)
+}
+
+// Close stops writing periodic snapshots, and writes a final snapshot to disk.
+// Close is safe to call more than once.
+func (pc *PersistentCache[T]) Close() error {
+	pc.once.Do(func() { close(pc.stop) })
+	<-pc.done
+	_ = pc.VolatileCache.Close()
+	return pc.Snapshot()
+}
+
+func (pc *PersistentCache[T]) snapshots(ticks <-chan time.Time, cancel func()) {
+	defer close(pc.done)
+	defer cancel()
+
+	for {
+		select {
+		case <-pc.stop:
+			return
+		case <-ticks:
+			// a failed snapshot is retried on the next tick
+			_ = pc.Snapshot()
+		}
+	}
+}
+
+func (pc *PersistentCache[T]) load() error {
+	b, err := os.ReadFile(pc.path)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return nil
+	case err != nil:
+		return fmt.Errorf("cache: unable to read snapshot: %w", err)
+	}
+
+	var s snapshot
+	if err = json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("cache: unable to decode snapshot: %w", err)
+	}
+
+	// restore from least to most recently used, preserving recency
+	for _, item := range slices.Backward(s.Items) {
+		value, derr := pc.codec.Decode(item.Value)
+		if derr != nil {
+			return fmt.Errorf("cache: unable to decode value: %w", derr)
+		}
+		pc.restore(item.Key, value, item.Expiration)
+	}
+
+	return nil
+}
+
+// writeAtomic writes b to a temporary file in the same directory as path, and
+// then renames the temporary file to path.
+func writeAtomic(path string, b []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("cache: unable to create snapshot: %w", err)
+	}
+	tmp := f.Name()
+
+	// cleanup the temporary file unless the rename succeeds
+	fail := func(err error) error {
+		_ = f.Close()
+		_ = os.Remove(tmp)
+		return fmt.Errorf("cache: unable to write snapshot: %w", err)
+	}
+
+	if _, err = f.Write(b); err != nil {
+		return fail(err)
+	}
+
+	if err = f.Sync(); err != nil {
+		return fail(err)
+	}
+
+	if err = f.Close(); err != nil {
+		return fail(err)
+	}
+
+	if err = os.Rename(tmp, path); err != nil {
+		return fail(err)
+	}
+
+	return nil
+}
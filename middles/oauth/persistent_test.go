@@ -0,0 +1,108 @@
+package oauth
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/shoenig/test/must"
+)
+
+func TestPersistentCache_restart(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "sessions.json")
+	now := testNow()
+
+	options := newVolatileOptions([]VolatileOption{SnapshotEvery(0)})
+	options.clock = func() time.Time { return now }
+
+	pc, err := newPersistentCache(path, size, JSONCodec[rowid]{}, options)
+	must.NoError(t, err)
+
+	pc.Put("short", 1, 1*time.Minute)
+	pc.Put("long", 2, 1*time.Hour)
+	must.NoError(t, pc.Close())
+
+	// no temporary files are left behind
+	entries, rerr := os.ReadDir(filepath.Dir(path))
+	must.NoError(t, rerr)
+	must.SliceLen(t, 1, entries)
+
+	// restart after the short item has expired
+	now = now.Add(2 * time.Minute)
+	pc2, err2 := newPersistentCache(path, size, JSONCodec[rowid]{}, options)
+	must.NoError(t, err2)
+	t.Cleanup(func() { _ = pc2.Close() })
+
+	_, exists := pc2.Get("short")
+	must.False(t, exists)
+
+	value, exists2 := pc2.Get("long")
+	must.True(t, exists2)
+	must.Eq(t, 2, value)
+
+	// remaining ttl is preserved
+	now = now.Add(1 * time.Hour)
+	_, exists3 := pc2.Get("long")
+	must.False(t, exists3)
+}
+
+func TestPersistentCache_recency(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "sessions.json")
+
+	pc, err := NewPersistentCache(path, 2, JSONCodec[string]{}, SnapshotEvery(0))
+	must.NoError(t, err)
+	pc.Put("a", "apple", 1*time.Hour)
+	pc.Put("b", "banana", 1*time.Hour)
+	_, _ = pc.Get("a") // a is now most recently used
+	must.NoError(t, pc.Close())
+
+	pc2, err2 := NewPersistentCache(path, 2, JSONCodec[string]{}, SnapshotEvery(0))
+	must.NoError(t, err2)
+	t.Cleanup(func() { _ = pc2.Close() })
+
+	// adding c evicts b, the least recently used
+	pc2.Put("c", "cherry", 1*time.Hour)
+	_, exists := pc2.Get("b")
+	must.False(t, exists)
+	_, exists = pc2.Get("a")
+	must.True(t, exists)
+}
+
+func TestPersistentCache_periodic(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "sessions.json")
+	ticks := make(chan time.Time)
+
+	options := newVolatileOptions(nil)
+	options.ticker = func(time.Duration) (<-chan time.Time, func()) {
+		return ticks, func() {}
+	}
+
+	pc, err := newPersistentCache(path, size, JSONCodec[int]{}, options)
+	must.NoError(t, err)
+	t.Cleanup(func() { _ = pc.Close() })
+
+	pc.Put("key", 1, 1*time.Hour)
+	ticks <- time.Now()
+	ticks <- time.Now() // blocks until the first snapshot is complete
+
+	b, rerr := os.ReadFile(path)
+	must.NoError(t, rerr)
+	must.StrContains(t, string(b), `"key":"key"`)
+}
+
+func TestPersistentCache_corrupt(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "sessions.json")
+	must.NoError(t, os.WriteFile(path, []byte("not json"), 0o600))
+
+	_, err := NewPersistentCache(path, size, JSONCodec[int]{})
+	must.ErrorContains(t, err, "unable to decode snapshot")
+}
@@ -0,0 +1,61 @@
+package oauth
+
+import (
+	"context"
+	"time"
+
+	"github.com/shoenig/go-conceal"
+)
+
+// Project adapts cache, which is keyed by string, into a Cache keyed by K, by
+// using project to convert each key of type K into a string.
+func Project[K, T any](cache Cache[string, T], project func(K) string) *Projection[K, T] {
+	return &Projection[K, T]{
+		cache:   cache,
+		project: project,
+	}
+}
+
+// TextKeys adapts cache into a Cache keyed by session tokens, enabling the use
+// of e.g. VolatileCache with Sessions.
+//
+//	sessions := NewSessions(cookies, TextKeys(NewVolatileCache[rowid](1000)))
+func TextKeys[T any](cache Cache[string, T]) *Projection[*conceal.Text, T] {
+	return Project(cache, (*conceal.Text).Unveil)
+}
+
+// Projection is a Cache keyed by K, backed by a Cache keyed by string.
+//
+// Projection implements ContextCache, making use of the optional capabilities
+// of the underlying Cache when available.
+type Projection[K, T any] struct {
+	cache   Cache[string, T]
+	project func(K) string
+}
+
+func (p *Projection[K, T]) Get(key K) (T, bool) {
+	return p.cache.Get(p.project(key))
+}
+
+func (p *Projection[K, T]) Put(key K, value T, ttl time.Duration) {
+	p.cache.Put(p.project(key), value, ttl)
+}
+
+func (p *Projection[K, T]) GetContext(ctx context.Context, key K) (T, bool, error) {
+	return Get(ctx, p.cache, p.project(key))
+}
+
+func (p *Projection[K, T]) PutContext(ctx context.Context, key K, value T, ttl time.Duration) error {
+	return Put(ctx, p.cache, p.project(key), value, ttl)
+}
+
+func (p *Projection[K, T]) DeleteContext(ctx context.Context, key K) error {
+	return Delete(ctx, p.cache, p.project(key))
+}
+
+// Observe forwards f to the underlying Cache, if it is Observable.
+func (p *Projection[K, T]) Observe(f func(Event)) {
+	if o, ok := p.cache.(Observable); ok {
+		o.Observe(f)
+	}
+}
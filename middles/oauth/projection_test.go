@@ -0,0 +1,67 @@
+package oauth
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/shoenig/go-conceal"
+	"github.com/shoenig/test/must"
+)
+
+var (
+	_ Cache[*conceal.Text, rowid]        = TextKeys[rowid](NewVolatileCache[rowid](size))
+	_ ContextCache[*conceal.Text, rowid] = TextKeys[rowid](NewVolatileCache[rowid](size))
+	_ *Sessions[rowid]                   = NewSessions(nil, TextKeys(NewVolatileCache[rowid](size)))
+)
+
+func TestProjection_Sessions(t *testing.T) {
+	t.Parallel()
+
+	sessions := NewSessions(&CookieFactory[rowid]{
+		Name:  "session-token",
+		Clock: testNow,
+	}, TextKeys(NewVolatileCache[rowid](size)))
+
+	id := rowid(12345)
+	cookie := sessions.Create(id, 1*time.Hour)
+	must.NotNil(t, cookie)
+
+	b, berr := base64.StdEncoding.DecodeString(cookie.Value)
+	must.NoError(t, berr)
+	cc := new(CookieContent[rowid])
+	must.NoError(t, json.Unmarshal(b, cc))
+
+	// a fresh copy of the token is matched by value
+	token := conceal.New(cc.UserToken)
+	must.NoError(t, sessions.Match(id, token))
+	must.ErrorIs(t, sessions.Match(id+1, token), ErrNotMatch)
+
+	// volatile cache supports deletion
+	must.NoError(t, sessions.Revoke(context.Background(), token))
+	must.ErrorIs(t, sessions.Match(id, token), ErrNotFound)
+}
+
+func TestProjection_Delete(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	p := TextKeys[rowid](&mockStringCache{storage: make(map[string]rowid)})
+	must.ErrorIs(t, Delete(ctx, p, conceal.New("key")), ErrNotSupported)
+}
+
+// mockStringCache is a Cache with no optional capabilities
+type mockStringCache struct {
+	storage map[string]rowid
+}
+
+func (m *mockStringCache) Get(k string) (rowid, bool) {
+	id, ok := m.storage[k]
+	return id, ok
+}
+
+func (m *mockStringCache) Put(k string, v rowid, _ time.Duration) {
+	m.storage[k] = v
+}
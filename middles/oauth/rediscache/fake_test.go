@@ -0,0 +1,217 @@
+package rediscache
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeServer is an in-process stand-in for a redis server, implementing just
+// enough of RESP and the command set to exercise Cache.
+type fakeServer struct {
+	listener net.Listener
+	password string
+
+	lock     sync.Mutex
+	now      time.Time
+	data     map[string]fakeItem
+	commands []string // names of commands received, in order
+	dials    int
+}
+
+type fakeItem struct {
+	value      string
+	expiration time.Time
+}
+
+func newFakeServer(t *testing.T, password string) *fakeServer {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fs := &fakeServer{
+		listener: listener,
+		password: password,
+		now:      time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC),
+		data:     make(map[string]fakeItem),
+	}
+
+	go fs.serve()
+	t.Cleanup(func() { _ = listener.Close() })
+	return fs
+}
+
+func (fs *fakeServer) address() string {
+	return fs.listener.Addr().String()
+}
+
+func (fs *fakeServer) advance(d time.Duration) {
+	fs.lock.Lock()
+	defer fs.lock.Unlock()
+	fs.now = fs.now.Add(d)
+}
+
+func (fs *fakeServer) received() []string {
+	fs.lock.Lock()
+	defer fs.lock.Unlock()
+	return append([]string(nil), fs.commands...)
+}
+
+func (fs *fakeServer) serve() {
+	for {
+		nc, err := fs.listener.Accept()
+		if err != nil {
+			return
+		}
+		fs.lock.Lock()
+		fs.dials++
+		fs.lock.Unlock()
+		go fs.handle(nc)
+	}
+}
+
+func (fs *fakeServer) handle(nc net.Conn) {
+	defer func() { _ = nc.Close() }()
+
+	r := bufio.NewReader(nc)
+	w := bufio.NewWriter(nc)
+	authenticated := fs.password == ""
+
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+
+		name := strings.ToUpper(args[0])
+		if name != "AUTH" && !authenticated {
+			_, _ = w.WriteString("-NOAUTH Authentication required.\r\n")
+		} else {
+			if name == "AUTH" {
+				authenticated = len(args) == 2 && args[1] == fs.password
+			}
+			_, _ = w.WriteString(fs.execute(name, args[1:]))
+		}
+
+		// only flush once the client has no more pipelined commands
+		if r.Buffered() == 0 {
+			if err = w.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (fs *fakeServer) execute(name string, args []string) string {
+	fs.lock.Lock()
+	defer fs.lock.Unlock()
+
+	fs.commands = append(fs.commands, name)
+
+	switch name {
+	case "AUTH":
+		if len(args) == 1 && args[0] == fs.password {
+			return "+OK\r\n"
+		}
+		return "-WRONGPASS invalid password\r\n"
+	case "SET":
+		// SET key value [NX] PX ms
+		nx := len(args) == 5 && strings.ToUpper(args[2]) == "NX"
+		if nx {
+			args = append(args[:2], args[3:]...)
+		}
+		if len(args) != 4 || strings.ToUpper(args[2]) != "PX" {
+			return "-ERR syntax error\r\n"
+		}
+		if _, exists := fs.lookup(args[0]); nx && exists {
+			return "$-1\r\n"
+		}
+		ms, err := strconv.Atoi(args[3])
+		if err != nil || ms <= 0 {
+			return "-ERR invalid expire time in 'set' command\r\n"
+		}
+		fs.data[args[0]] = fakeItem{
+			value:      args[1],
+			expiration: fs.now.Add(time.Duration(ms) * time.Millisecond),
+		}
+		return "+OK\r\n"
+	case "GET", "GETDEL":
+		item, exists := fs.lookup(args[0])
+		if !exists {
+			return "$-1\r\n"
+		}
+		if name == "GETDEL" {
+			delete(fs.data, args[0])
+		}
+		return fmt.Sprintf("$%d\r\n%s\r\n", len(item.value), item.value)
+	case "DEL":
+		_, exists := fs.lookup(args[0])
+		delete(fs.data, args[0])
+		if exists {
+			return ":1\r\n"
+		}
+		return ":0\r\n"
+	default:
+		return "-ERR unknown command '" + name + "'\r\n"
+	}
+}
+
+// lookup an unexpired item; the lock must be held
+func (fs *fakeServer) lookup(key string) (fakeItem, bool) {
+	item, exists := fs.data[key]
+	if exists && !fs.now.Before(item.expiration) {
+		delete(fs.data, key)
+		return item, false
+	}
+	return item, exists
+}
+
+func readCommand(r *bufio.Reader) ([]string, error) {
+	header, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(header, "*") {
+		return nil, errors.New("expected array")
+	}
+	n, err := strconv.Atoi(header[1:])
+	if err != nil {
+		return nil, err
+	}
+
+	args := make([]string, 0, n)
+	for range n {
+		line, lerr := readLine(r)
+		if lerr != nil {
+			return nil, lerr
+		}
+		size, serr := strconv.Atoi(strings.TrimPrefix(line, "$"))
+		if serr != nil {
+			return nil, serr
+		}
+		b := make([]byte, size+2)
+		if _, err = io.ReadFull(r, b); err != nil {
+			return nil, err
+		}
+		args = append(args, string(b[:size]))
+	}
+	return args, nil
+}
+
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(line, "\r\n"), nil
+}
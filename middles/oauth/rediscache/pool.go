@@ -0,0 +1,115 @@
+package rediscache
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+)
+
+// ErrClosed indicates the Cache has been closed.
+var ErrClosed = errors.New("rediscache: cache is closed")
+
+// pool is a bounded pool of connections to the redis server
+type pool struct {
+	dial  func(context.Context) (*conn, error)
+	slots chan struct{} // a slot is held for each connection in use
+	idle  chan *conn
+	done  chan struct{}
+
+	lock   sync.Mutex
+	closed bool
+}
+
+func newPool(size int, dial func(context.Context) (*conn, error)) *pool {
+	return &pool{
+		dial:  dial,
+		slots: make(chan struct{}, size),
+		idle:  make(chan *conn, size),
+		done:  make(chan struct{}),
+	}
+}
+
+// get a connection from the pool, dialing a new connection if there are no
+// idle connections, or waiting if the pool is exhausted
+func (p *pool) get(ctx context.Context) (*conn, error) {
+	select {
+	case <-p.done:
+		return nil, ErrClosed
+	default:
+	}
+
+	select {
+	case <-p.done:
+		return nil, ErrClosed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case p.slots <- struct{}{}:
+	}
+
+	select {
+	case c := <-p.idle:
+		return c, nil
+	default:
+	}
+
+	c, err := p.dial(ctx)
+	if err != nil {
+		<-p.slots
+		return nil, err
+	}
+	return c, nil
+}
+
+// put c back into the pool; connections which experienced an error are
+// discarded, as their state is unknown
+func (p *pool) put(c *conn, err error) {
+	defer func() { <-p.slots }()
+
+	var redisErr Error
+	if err != nil && !errors.As(err, &redisErr) {
+		c.close()
+		return
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.closed {
+		c.close()
+		return
+	}
+
+	select {
+	case p.idle <- c:
+	default:
+		c.close()
+	}
+}
+
+func (p *pool) close() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.closed {
+		return
+	}
+	p.closed = true
+	close(p.done)
+
+	for {
+		select {
+		case c := <-p.idle:
+			c.close()
+		default:
+			return
+		}
+	}
+}
+
+func dialer(address string) func(context.Context) (net.Conn, error) {
+	d := new(net.Dialer)
+	return func(ctx context.Context) (net.Conn, error) {
+		return d.DialContext(ctx, "tcp", address)
+	}
+}
@@ -0,0 +1,295 @@
+// Package rediscache provides an implementation of oauth.Cache backed by a
+// redis server, speaking the RESP protocol directly.
+package rediscache
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	"cattlecloud.net/go/webtools/middles/oauth"
+	"github.com/shoenig/go-conceal"
+)
+
+type Options struct {
+	address  string
+	prefix   string
+	poolSize int
+	timeout  time.Duration
+	password *conceal.Text
+	dialer   func(context.Context) (net.Conn, error)
+}
+
+type OptionFunc func(*Options)
+
+// SetAddress sets the host:port address of the redis server. The default
+// address is localhost:6379.
+func SetAddress(address string) OptionFunc {
+	return func(o *Options) { o.address = address }
+}
+
+// SetPrefix sets a prefix applied to every key, enabling many caches to share
+// one redis server.
+func SetPrefix(prefix string) OptionFunc {
+	return func(o *Options) { o.prefix = prefix }
+}
+
+// SetPoolSize sets the maximum number of connections to the redis server.
+func SetPoolSize(size int) OptionFunc {
+	return func(o *Options) { o.poolSize = size }
+}
+
+// SetTimeout sets the timeout of operations which are not given a context, or
+// are given a context with no deadline.
+func SetTimeout(timeout time.Duration) OptionFunc {
+	return func(o *Options) { o.timeout = timeout }
+}
+
+// SetPassword sets the password used to AUTH each new connection.
+func SetPassword(password *conceal.Text) OptionFunc {
+	return func(o *Options) { o.password = password }
+}
+
+// SetDialer overrides how connections to the redis server are established,
+// e.g. for using TLS. The address option is ignored if a dialer is set.
+func SetDialer(dialer func(context.Context) (net.Conn, error)) OptionFunc {
+	return func(o *Options) { o.dialer = dialer }
+}
+
+// New creates a Cache backed by a redis server, using codec to encode and
+// decode values.
+func New[T any](codec oauth.Codec[T], opts ...OptionFunc) *Cache[T] {
+	options := &Options{
+		address:  "localhost:6379",
+		poolSize: 8,
+		timeout:  5 * time.Second,
+	}
+
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	if options.dialer == nil {
+		options.dialer = dialer(options.address)
+	}
+
+	c := &Cache[T]{
+		codec:   codec,
+		prefix:  options.prefix,
+		timeout: options.timeout,
+	}
+
+	c.pool = newPool(options.poolSize, func(ctx context.Context) (*conn, error) {
+		nc, err := options.dialer(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("rediscache: unable to connect: %w", err)
+		}
+		cn := newConn(nc)
+		if options.password != nil {
+			if err = c.auth(ctx, cn, options.password); err != nil {
+				cn.close()
+				return nil, err
+			}
+		}
+		return cn, nil
+	})
+
+	return c
+}
+
+// Cache is an implementation of oauth.Cache backed by a redis server.
+//
+// Cache implements oauth.ContextCache, oauth.Taker, and oauth.Adder, and
+// operations without a context which fail are treated as cache misses.
+type Cache[T any] struct {
+	codec   oauth.Codec[T]
+	prefix  string
+	timeout time.Duration
+	pool    *pool
+}
+
+func (c *Cache[T]) Get(key string) (T, bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	value, exists, _ := c.GetContext(ctx, key)
+	return value, exists
+}
+
+func (c *Cache[T]) Put(key string, value T, ttl time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	_ = c.PutContext(ctx, key, value, ttl)
+}
+
+func (c *Cache[T]) Delete(key string) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	_ = c.DeleteContext(ctx, key)
+}
+
+func (c *Cache[T]) GetContext(ctx context.Context, key string) (T, bool, error) {
+	values, err := c.GetMany(ctx, []string{key})
+	value, exists := values[key]
+	return value, exists, err
+}
+
+func (c *Cache[T]) PutContext(ctx context.Context, key string, value T, ttl time.Duration) error {
+	return c.PutMany(ctx, map[string]T{key: value}, ttl)
+}
+
+func (c *Cache[T]) DeleteContext(ctx context.Context, key string) error {
+	replies, err := c.do(ctx, [][]string{{"DEL", c.prefix + key}})
+	if err != nil {
+		return err
+	}
+	return replies[0].err()
+}
+
+// Take atomically gets and deletes key, using the GETDEL command (redis 6.2 or
+// later).
+func (c *Cache[T]) Take(ctx context.Context, key string) (T, bool, error) {
+	var empty T
+
+	replies, err := c.do(ctx, [][]string{{"GETDEL", c.prefix + key}})
+	if err != nil {
+		return empty, false, err
+	}
+
+	r := replies[0]
+	if rerr := r.err(); rerr != nil {
+		return empty, false, rerr
+	}
+	if r.null {
+		return empty, false, nil
+	}
+
+	value, err := c.codec.Decode(r.str)
+	if err != nil {
+		return empty, false, fmt.Errorf("rediscache: unable to decode value: %w", err)
+	}
+
+	return value, true, nil
+}
+
+// Add sets key only if key does not exist, using the SET command with the NX
+// option.
+func (c *Cache[T]) Add(ctx context.Context, key string, value T, ttl time.Duration) (bool, error) {
+	b, err := c.codec.Encode(value)
+	if err != nil {
+		return false, fmt.Errorf("rediscache: unable to encode value: %w", err)
+	}
+
+	ms := strconv.FormatInt(max(ttl.Milliseconds(), 1), 10)
+	replies, err := c.do(ctx, [][]string{{"SET", c.prefix + key, string(b), "NX", "PX", ms}})
+	if err != nil {
+		return false, err
+	}
+
+	r := replies[0]
+	if rerr := r.err(); rerr != nil {
+		return false, rerr
+	}
+
+	// a null reply means the key already exists
+	return !r.null, nil
+}
+
+// GetMany gets the values of keys in a single round trip to the redis server.
+// Keys which do not exist are omitted from the result.
+func (c *Cache[T]) GetMany(ctx context.Context, keys []string) (map[string]T, error) {
+	commands := make([][]string, 0, len(keys))
+	for _, key := range keys {
+		commands = append(commands, []string{"GET", c.prefix + key})
+	}
+
+	replies, err := c.do(ctx, commands)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]T, len(keys))
+	for i, r := range replies {
+		if rerr := r.err(); rerr != nil {
+			return nil, rerr
+		}
+		if r.null {
+			continue
+		}
+		value, derr := c.codec.Decode(r.str)
+		if derr != nil {
+			return nil, fmt.Errorf("rediscache: unable to decode value: %w", derr)
+		}
+		values[keys[i]] = value
+	}
+
+	return values, nil
+}
+
+// PutMany sets the values of items in a single round trip to the redis server,
+// each expiring after ttl.
+func (c *Cache[T]) PutMany(ctx context.Context, items map[string]T, ttl time.Duration) error {
+	ms := strconv.FormatInt(max(ttl.Milliseconds(), 1), 10)
+
+	commands := make([][]string, 0, len(items))
+	for key, value := range items {
+		b, err := c.codec.Encode(value)
+		if err != nil {
+			return fmt.Errorf("rediscache: unable to encode value: %w", err)
+		}
+		commands = append(commands, []string{"SET", c.prefix + key, string(b), "PX", ms})
+	}
+
+	replies, err := c.do(ctx, commands)
+	if err != nil {
+		return err
+	}
+
+	for _, r := range replies {
+		if rerr := r.err(); rerr != nil {
+			return rerr
+		}
+	}
+
+	return nil
+}
+
+// Close all connections to the redis server.
+func (c *Cache[T]) Close() error {
+	c.pool.close()
+	return nil
+}
+
+func (c *Cache[T]) do(ctx context.Context, commands [][]string) ([]*reply, error) {
+	if len(commands) == 0 {
+		return nil, nil
+	}
+
+	cn, err := c.pool.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	replies, err := cn.pipeline(ctx, c.timeout, commands)
+	c.pool.put(cn, err)
+	if err != nil {
+		return nil, fmt.Errorf("rediscache: request failed: %w", err)
+	}
+
+	return replies, nil
+}
+
+func (c *Cache[T]) auth(ctx context.Context, cn *conn, password *conceal.Text) error {
+	replies, err := cn.pipeline(ctx, c.timeout, [][]string{{"AUTH", password.Unveil()}})
+	if err != nil {
+		return fmt.Errorf("rediscache: unable to authenticate: %w", err)
+	}
+	if rerr := replies[0].err(); rerr != nil {
+		return fmt.Errorf("rediscache: unable to authenticate: %w", rerr)
+	}
+	return nil
+}
@@ -0,0 +1,192 @@
+package rediscache
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"cattlecloud.net/go/webtools/middles/oauth"
+	"github.com/shoenig/go-conceal"
+	"github.com/shoenig/test/must"
+)
+
+var (
+	_ oauth.Cache[string, int]        = (*Cache[int])(nil)
+	_ oauth.ContextCache[string, int] = (*Cache[int])(nil)
+	_ oauth.Deleter[string]           = (*Cache[int])(nil)
+	_ oauth.Taker[string, int]        = (*Cache[int])(nil)
+	_ oauth.Adder[string, int]        = (*Cache[int])(nil)
+)
+
+type session struct {
+	UserID int `json:"user_id"`
+}
+
+func TestCache_GetPut(t *testing.T) {
+	t.Parallel()
+
+	fs := newFakeServer(t, "")
+	c := New(oauth.JSONCodec[*session]{}, SetAddress(fs.address()))
+	t.Cleanup(func() { _ = c.Close() })
+
+	ctx := context.Background()
+
+	_, exists, err := c.GetContext(ctx, "missing")
+	must.NoError(t, err)
+	must.False(t, exists)
+
+	must.NoError(t, c.PutContext(ctx, "key", &session{UserID: 7}, 1*time.Minute))
+	value, exists, err := c.GetContext(ctx, "key")
+	must.NoError(t, err)
+	must.True(t, exists)
+	must.Eq(t, 7, value.UserID)
+
+	// expiration is enforced by the server
+	fs.advance(2 * time.Minute)
+	_, exists = c.Get("key")
+	must.False(t, exists)
+}
+
+func TestCache_Delete(t *testing.T) {
+	t.Parallel()
+
+	fs := newFakeServer(t, "")
+	c := New(oauth.JSONCodec[int]{}, SetAddress(fs.address()))
+	t.Cleanup(func() { _ = c.Close() })
+
+	c.Put("key", 1, 1*time.Minute)
+	c.Delete("key")
+	_, exists := c.Get("key")
+	must.False(t, exists)
+}
+
+func TestCache_Take(t *testing.T) {
+	t.Parallel()
+
+	fs := newFakeServer(t, "")
+	c := New(oauth.JSONCodec[int]{}, SetAddress(fs.address()))
+	t.Cleanup(func() { _ = c.Close() })
+
+	ctx := context.Background()
+
+	c.Put("key", 1, 1*time.Minute)
+	value, exists, err := c.Take(ctx, "key")
+	must.NoError(t, err)
+	must.True(t, exists)
+	must.Eq(t, 1, value)
+
+	_, exists, err = c.Take(ctx, "key")
+	must.NoError(t, err)
+	must.False(t, exists)
+}
+
+func TestCache_Add(t *testing.T) {
+	t.Parallel()
+
+	fs := newFakeServer(t, "")
+	c := New(oauth.JSONCodec[int]{}, SetAddress(fs.address()))
+	t.Cleanup(func() { _ = c.Close() })
+
+	ctx := context.Background()
+
+	added, err := c.Add(ctx, "key", 1, 1*time.Minute)
+	must.NoError(t, err)
+	must.True(t, added)
+
+	added, err = c.Add(ctx, "key", 2, 1*time.Minute)
+	must.NoError(t, err)
+	must.False(t, added)
+
+	value, exists := c.Get("key")
+	must.True(t, exists)
+	must.Eq(t, 1, value)
+}
+
+func TestCache_prefix(t *testing.T) {
+	t.Parallel()
+
+	fs := newFakeServer(t, "")
+	a := New(oauth.JSONCodec[int]{}, SetAddress(fs.address()), SetPrefix("a:"))
+	b := New(oauth.JSONCodec[int]{}, SetAddress(fs.address()), SetPrefix("b:"))
+	t.Cleanup(func() { _ = a.Close(); _ = b.Close() })
+
+	a.Put("key", 1, 1*time.Minute)
+	b.Put("key", 2, 1*time.Minute)
+
+	value, _ := a.Get("key")
+	must.Eq(t, 1, value)
+
+	fs.lock.Lock()
+	must.MapContainsKeys(t, fs.data, []string{"a:key", "b:key"})
+	fs.lock.Unlock()
+}
+
+func TestCache_pipeline(t *testing.T) {
+	t.Parallel()
+
+	fs := newFakeServer(t, "")
+	c := New(oauth.JSONCodec[int]{}, SetAddress(fs.address()), SetPoolSize(1))
+	t.Cleanup(func() { _ = c.Close() })
+
+	ctx := context.Background()
+	must.NoError(t, c.PutMany(ctx, map[string]int{"a": 1, "b": 2, "c": 3}, 1*time.Minute))
+
+	values, err := c.GetMany(ctx, []string{"a", "b", "c", "d"})
+	must.NoError(t, err)
+	must.MapEq(t, map[string]int{"a": 1, "b": 2, "c": 3}, values)
+
+	must.Eq(t, []string{"SET", "SET", "SET", "GET", "GET", "GET", "GET"}, fs.received())
+}
+
+func TestCache_pool(t *testing.T) {
+	t.Parallel()
+
+	fs := newFakeServer(t, "")
+	c := New(oauth.JSONCodec[int]{}, SetAddress(fs.address()), SetPoolSize(2))
+	t.Cleanup(func() { _ = c.Close() })
+
+	var wg sync.WaitGroup
+	for i := range 50 {
+		wg.Go(func() {
+			c.Put("key", i, 1*time.Minute)
+			_, _ = c.Get("key")
+		})
+	}
+	wg.Wait()
+
+	// connections are reused, and never more than the pool size
+	fs.lock.Lock()
+	must.LessEq(t, 2, fs.dials)
+	fs.lock.Unlock()
+}
+
+func TestCache_auth(t *testing.T) {
+	t.Parallel()
+
+	fs := newFakeServer(t, "hunter2")
+
+	t.Run("correct", func(t *testing.T) {
+		c := New(oauth.JSONCodec[int]{}, SetAddress(fs.address()), SetPassword(conceal.New("hunter2")))
+		t.Cleanup(func() { _ = c.Close() })
+		must.NoError(t, c.PutContext(context.Background(), "key", 1, time.Minute))
+	})
+
+	t.Run("incorrect", func(t *testing.T) {
+		c := New(oauth.JSONCodec[int]{}, SetAddress(fs.address()), SetPassword(conceal.New("wrong")))
+		t.Cleanup(func() { _ = c.Close() })
+		err := c.PutContext(context.Background(), "key", 1, time.Minute)
+		must.ErrorContains(t, err, "unable to authenticate")
+	})
+}
+
+func TestCache_closed(t *testing.T) {
+	t.Parallel()
+
+	fs := newFakeServer(t, "")
+	c := New(oauth.JSONCodec[int]{}, SetAddress(fs.address()))
+	must.NoError(t, c.Close())
+
+	_, _, err := c.GetContext(context.Background(), "key")
+	must.ErrorIs(t, err, ErrClosed)
+}
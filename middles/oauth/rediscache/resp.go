@@ -0,0 +1,171 @@
+package rediscache
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+// Error is an error reply sent by the redis server.
+type Error string
+
+func (e Error) Error() string {
+	return "rediscache: " + string(e)
+}
+
+// reply is a decoded RESP reply
+type reply struct {
+	kind  byte // one of + - : $ *
+	str   []byte
+	num   int64
+	null  bool
+	array []*reply
+}
+
+// conn is a connection to the redis server
+type conn struct {
+	nc net.Conn
+	r  *bufio.Reader
+	w  *bufio.Writer
+}
+
+func newConn(nc net.Conn) *conn {
+	return &conn{
+		nc: nc,
+		r:  bufio.NewReader(nc),
+		w:  bufio.NewWriter(nc),
+	}
+}
+
+// pipeline writes every command before reading any replies, such that many
+// commands are sent in a single round trip
+func (c *conn) pipeline(ctx context.Context, timeout time.Duration, commands [][]string) ([]*reply, error) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(timeout)
+	}
+	if err := c.nc.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+
+	for _, command := range commands {
+		if err := c.write(command); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := c.w.Flush(); err != nil {
+		return nil, err
+	}
+
+	replies := make([]*reply, 0, len(commands))
+	for range commands {
+		r, err := c.read()
+		if err != nil {
+			return nil, err
+		}
+		replies = append(replies, r)
+	}
+
+	return replies, nil
+}
+
+// write command as an array of bulk strings
+func (c *conn) write(command []string) error {
+	if _, err := fmt.Fprintf(c.w, "*%d\r\n", len(command)); err != nil {
+		return err
+	}
+	for _, arg := range command {
+		if _, err := fmt.Fprintf(c.w, "$%d\r\n%s\r\n", len(arg), arg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *conn) read() (*reply, error) {
+	line, err := c.line()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(line) == 0 {
+		return nil, errors.New("rediscache: empty reply")
+	}
+
+	r := &reply{kind: line[0]}
+	body := string(line[1:])
+
+	switch r.kind {
+	case '+', '-':
+		r.str = []byte(body)
+	case ':':
+		if r.num, err = strconv.ParseInt(body, 10, 64); err != nil {
+			return nil, fmt.Errorf("rediscache: malformed integer reply: %w", err)
+		}
+	case '$':
+		n, perr := strconv.Atoi(body)
+		if perr != nil {
+			return nil, fmt.Errorf("rediscache: malformed bulk reply: %w", perr)
+		}
+		if n < 0 {
+			r.null = true
+			return r, nil
+		}
+		r.str = make([]byte, n+2)
+		if _, err = io.ReadFull(c.r, r.str); err != nil {
+			return nil, err
+		}
+		r.str = r.str[:n]
+	case '*':
+		n, perr := strconv.Atoi(body)
+		if perr != nil {
+			return nil, fmt.Errorf("rediscache: malformed array reply: %w", perr)
+		}
+		if n < 0 {
+			r.null = true
+			return r, nil
+		}
+		r.array = make([]*reply, 0, n)
+		for range n {
+			element, rerr := c.read()
+			if rerr != nil {
+				return nil, rerr
+			}
+			r.array = append(r.array, element)
+		}
+	default:
+		return nil, fmt.Errorf("rediscache: unexpected reply type %q", r.kind)
+	}
+
+	return r, nil
+}
+
+// line reads one CRLF terminated line, excluding the CRLF
+func (c *conn) line() ([]byte, error) {
+	line, err := c.r.ReadSlice('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 2 || line[len(line)-2] != '\r' {
+		return nil, errors.New("rediscache: malformed reply")
+	}
+	return line[:len(line)-2], nil
+}
+
+func (c *conn) close() {
+	_ = c.nc.Close()
+}
+
+// err returns the error of an error reply, if r is an error reply
+func (r *reply) err() error {
+	if r.kind == '-' {
+		return Error(r.str)
+	}
+	return nil
+}
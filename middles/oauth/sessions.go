@@ -1,7 +1,9 @@
 package oauth
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"net/http"
 	"time"
 
@@ -16,14 +18,11 @@ var (
 	// the request context, likely indicating a malicious user fudging a session
 	// value.
 	ErrNotMatch = errors.New("session: not a match")
-)
 
-// Cache could be implemented using an in-memory cache, a memcached instance,
-// or even persistent storage.
-type Cache[K, T any] interface {
-	Get(K) (T, bool)
-	Put(K, T, time.Duration)
-}
+	// ErrCache indicates the session cache failed to store or retrieve a
+	// session.
+	ErrCache = errors.New("session: cache failure")
+)
 
 // Unique is a unique number assigned to each user that can be associated
 // with any number of sessions. Typically a ROWID number from a database.
@@ -38,6 +37,10 @@ type Sessions[U Unique] struct {
 
 // NewSessions creates a new Sessions for managing sessions and cookies
 // associated with those sessions.
+//
+// To measure the use of the cache, wrap it with Instrument.
+//
+//	sessions := NewSessions(cookies, Instrument("sessions", cache, sink))
 func NewSessions[U Unique](cookies *CookieFactory[U], cache Cache[*conceal.Text, U]) *Sessions[U] {
 	return &Sessions[U]{
 		Cache:         cache,
@@ -45,17 +48,37 @@ func NewSessions[U Unique](cookies *CookieFactory[U], cache Cache[*conceal.Text,
 	}
 }
 
+// Create a new session for id, returning the cookie to be set on the client.
+//
+// If the session cannot be stored in the Cache, nil is returned; use
+// CreateContext to get the underlying error.
 func (s *Sessions[U]) Create(id U, ttl time.Duration) *http.Cookie {
-	token := conceal.UUIDv4()
-	cookie := s.CookieFactory.Create(id, token, ttl)
-	s.Cache.Put(token, id, ttl)
+	cookie, _ := s.CreateContext(context.Background(), id, ttl)
 	return cookie
 }
 
+// CreateContext creates a new session for id, returning the cookie to be set
+// on the client.
+func (s *Sessions[U]) CreateContext(ctx context.Context, id U, ttl time.Duration) (*http.Cookie, error) {
+	token := conceal.UUIDv4()
+	if err := Put(ctx, s.Cache, token, id, ttl); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrCache, err)
+	}
+	return s.CookieFactory.Create(id, token, ttl), nil
+}
+
+// Match returns nil if token is of a session belonging to id.
 func (s *Sessions[U]) Match(id U, token *conceal.Text) error {
-	actual, exists := s.Cache.Get(token)
+	return s.MatchContext(context.Background(), id, token)
+}
+
+// MatchContext returns nil if token is of a session belonging to id.
+func (s *Sessions[U]) MatchContext(ctx context.Context, id U, token *conceal.Text) error {
+	actual, exists, err := Get(ctx, s.Cache, token)
 
 	switch {
+	case err != nil:
+		return fmt.Errorf("%w: %w", ErrCache, err)
 	case !exists:
 		return ErrNotFound
 	case id != actual:
@@ -64,3 +87,14 @@ func (s *Sessions[U]) Match(id U, token *conceal.Text) error {
 		return nil
 	}
 }
+
+// Revoke the session of token, such that it can no longer be matched.
+//
+// The Cache must implement Deleter or ContextCache, otherwise ErrNotSupported
+// is returned.
+func (s *Sessions[U]) Revoke(ctx context.Context, token *conceal.Text) error {
+	if err := Delete(ctx, s.Cache, token); err != nil {
+		return fmt.Errorf("%w: %w", ErrCache, err)
+	}
+	return nil
+}
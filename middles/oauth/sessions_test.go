@@ -1,6 +1,7 @@
 package oauth
 
 import (
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"testing"
@@ -90,3 +91,73 @@ func TestSessions_Match(t *testing.T) {
 		must.ErrorIs(t, err, ErrNotMatch)
 	})
 }
+
+// deletingCache extends mockCache with support for Deleter
+type deletingCache struct {
+	mockCache
+}
+
+func (d *deletingCache) Delete(k *conceal.Text) {
+	delete(d.storage, k.Unveil())
+}
+
+// brokenCache is a ContextCache which always fails
+type brokenCache struct {
+	mockCache
+}
+
+func (*brokenCache) GetContext(context.Context, *conceal.Text) (rowid, bool, error) {
+	return 0, false, errBackend
+}
+
+func (*brokenCache) PutContext(context.Context, *conceal.Text, rowid, time.Duration) error {
+	return errBackend
+}
+
+func (*brokenCache) DeleteContext(context.Context, *conceal.Text) error {
+	return errBackend
+}
+
+func TestSessions_Revoke(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	id := rowid(12345)
+	token := conceal.UUIDv4()
+
+	t.Run("supported", func(t *testing.T) {
+		cache := &deletingCache{mockCache{storage: make(map[string]rowid)}}
+		sessions := NewSessions(nil, cache)
+		cache.Put(token, id, 1*time.Hour)
+
+		must.NoError(t, sessions.Match(id, token))
+		must.NoError(t, sessions.Revoke(ctx, token))
+		must.ErrorIs(t, sessions.Match(id, token), ErrNotFound)
+	})
+
+	t.Run("not supported", func(t *testing.T) {
+		cache := &mockCache{storage: make(map[string]rowid)}
+		sessions := NewSessions(nil, cache)
+
+		err := sessions.Revoke(ctx, token)
+		must.ErrorIs(t, err, ErrCache)
+		must.ErrorIs(t, err, ErrNotSupported)
+	})
+}
+
+func TestSessions_cacheFailure(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	cache := &brokenCache{mockCache{storage: make(map[string]rowid)}}
+	sessions := NewSessions(&CookieFactory[rowid]{Clock: testNow}, cache)
+
+	cookie, err := sessions.CreateContext(ctx, 1, 1*time.Hour)
+	must.ErrorIs(t, err, errBackend)
+	must.Nil(t, cookie)
+	must.Nil(t, sessions.Create(1, 1*time.Hour))
+
+	err = sessions.Match(1, conceal.UUIDv4())
+	must.ErrorIs(t, err, ErrCache)
+	must.ErrorIs(t, err, errBackend)
+}
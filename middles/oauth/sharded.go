@@ -0,0 +1,110 @@
+package oauth
+
+import (
+	"context"
+	"hash/maphash"
+	"iter"
+	"time"
+)
+
+// NewShardedCache creates an in-memory implementation of Cache, which spreads
+// keys across a number of independently locked VolatileCache shards.
+//
+// The cache holds at most size items, divided evenly among the shards. A size
+// of zero or less means the cache is unbounded. Options apply to every shard.
+func NewShardedCache[T any](shards, size int, opts ...VolatileOption) *ShardedCache[T] {
+	shards = max(shards, 1)
+
+	per := 0
+	if size > 0 {
+		per = (size + shards - 1) / shards
+	}
+
+	sc := &ShardedCache[T]{
+		seed:   maphash.MakeSeed(),
+		shards: make([]*VolatileCache[T], 0, shards),
+	}
+	for range shards {
+		sc.shards = append(sc.shards, NewVolatileCache[T](per, opts...))
+	}
+	return sc
+}
+
+// ShardedCache is an in-memory implementation of Cache, suitable for services
+// where contention on the single lock of VolatileCache is a bottleneck.
+//
+// Items expire in the same way as in VolatileCache; however eviction of least
+// recently used items happens per shard, and is only approximate across the
+// cache as a whole.
+type ShardedCache[T any] struct {
+	seed   maphash.Seed
+	shards []*VolatileCache[T]
+}
+
+func (sc *ShardedCache[T]) shard(path string) *VolatileCache[T] {
+	h := maphash.String(sc.seed, path)
+	return sc.shards[h%uint64(len(sc.shards))]
+}
+
+func (sc *ShardedCache[T]) Get(path string) (T, bool) {
+	return sc.shard(path).Get(path)
+}
+
+func (sc *ShardedCache[T]) Put(path string, value T, ttl time.Duration) {
+	sc.shard(path).Put(path, value, ttl)
+}
+
+// Delete the item of path from the cache, if it exists.
+func (sc *ShardedCache[T]) Delete(path string) {
+	sc.shard(path).Delete(path)
+}
+
+// Take atomically gets and deletes the item of path from the cache.
+func (sc *ShardedCache[T]) Take(ctx context.Context, path string) (T, bool, error) {
+	return sc.shard(path).Take(ctx, path)
+}
+
+// Add puts the item of path into the cache only if no unexpired item of path
+// exists, returning whether the item was put.
+func (sc *ShardedCache[T]) Add(ctx context.Context, path string, value T, ttl time.Duration) (bool, error) {
+	return sc.shard(path).Add(ctx, path, value, ttl)
+}
+
+// Len returns the number of unexpired items in the cache.
+func (sc *ShardedCache[T]) Len() int {
+	count := 0
+	for _, shard := range sc.shards {
+		count += shard.Len()
+	}
+	return count
+}
+
+// All returns an iterator over the unexpired items in the cache, one shard at
+// a time.
+func (sc *ShardedCache[T]) All() iter.Seq2[string, T] {
+	return func(yield func(string, T) bool) {
+		for _, shard := range sc.shards {
+			for k, v := range shard.All() {
+				if !yield(k, v) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// Observe adds f to be called when an item of any shard is purged because it
+// expired, or is evicted to make room for another item.
+func (sc *ShardedCache[T]) Observe(f func(Event)) {
+	for _, shard := range sc.shards {
+		shard.Observe(f)
+	}
+}
+
+// Close stops the background sweeper goroutine of each shard, if any.
+func (sc *ShardedCache[T]) Close() error {
+	for _, shard := range sc.shards {
+		_ = shard.Close()
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package oauth
+
+import (
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/shoenig/test/must"
+)
+
+var (
+	_ Cache[string, int]  = (*ShardedCache[int])(nil)
+	_ Deleter[string]     = (*ShardedCache[int])(nil)
+	_ Counter             = (*ShardedCache[int])(nil)
+	_ Ranger[string, int] = (*ShardedCache[int])(nil)
+)
+
+func TestShardedCache(t *testing.T) {
+	t.Parallel()
+
+	t.Run("get put", func(t *testing.T) {
+		sc := NewShardedCache[int](4, 100)
+		for i := range 50 {
+			sc.Put(strconv.Itoa(i), i, 1*time.Minute)
+		}
+		for i := range 50 {
+			value, ok := sc.Get(strconv.Itoa(i))
+			must.True(t, ok)
+			must.Eq(t, i, value)
+		}
+		must.Eq(t, 50, sc.Len())
+
+		count := 0
+		for range sc.All() {
+			count++
+		}
+		must.Eq(t, 50, count)
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		sc := NewShardedCache[int](4, 100)
+		sc.Put("a", 1, 1*time.Minute)
+		sc.Delete("a")
+		_, ok := sc.Get("a")
+		must.False(t, ok)
+	})
+
+	t.Run("expiration", func(t *testing.T) {
+		now := time.Now()
+		sc := NewShardedCache[int](4, 100)
+		for _, shard := range sc.shards {
+			shard.clock = func() time.Time { return now }
+		}
+
+		sc.Put("a", 1, 1*time.Minute)
+		now = now.Add(2 * time.Minute)
+		_, ok := sc.Get("a")
+		must.False(t, ok)
+	})
+
+	t.Run("bounded", func(t *testing.T) {
+		sc := NewShardedCache[int](4, 10)
+		for i := range 100 {
+			sc.Put(strconv.Itoa(i), i, 1*time.Minute)
+		}
+		// each shard holds at most ceil(10/4) items
+		must.LessEq(t, 12, sc.Len())
+	})
+
+	t.Run("close", func(t *testing.T) {
+		sc := NewShardedCache[int](4, 10, SweepEvery(1*time.Hour))
+		must.NoError(t, sc.Close())
+	})
+}
+
+// benchmarkCache exercises c under parallel load, where most operations are
+// reads of existing sessions, as with SetSession
+func benchmarkCache(b *testing.B, c Cache[string, int]) {
+	keys := make([]string, 1024)
+	for i := range keys {
+		keys[i] = strconv.Itoa(i)
+		c.Put(keys[i], i, 1*time.Hour)
+	}
+
+	// each goroutine starts at a different key
+	var offset atomic.Int64
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := int(offset.Add(97))
+		for pb.Next() {
+			key := keys[i%len(keys)]
+			if i%16 == 0 {
+				c.Put(key, i, 1*time.Hour)
+			} else {
+				_, _ = c.Get(key)
+			}
+			i++
+		}
+	})
+}
+
+func BenchmarkVolatileCache_parallel(b *testing.B) {
+	benchmarkCache(b, NewVolatileCache[int](4096))
+}
+
+func BenchmarkShardedCache_parallel(b *testing.B) {
+	benchmarkCache(b, NewShardedCache[int](32, 4096))
+}
@@ -0,0 +1,94 @@
+package sqlcache
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Dialect describes the SQL syntax differences between database engines.
+//
+// Consider using one of the pre-defined dialects.
+type Dialect struct {
+	name string
+
+	// bind returns the placeholder of the nth (1-indexed) query argument
+	bind func(int) string
+
+	// upsert is the clause appended to an INSERT statement for replacing the
+	// value and expiration of an existing key
+	upsert string
+
+	// insertIgnore and ignore are the keywords of an INSERT statement which
+	// does nothing if the key already exists
+	insertIgnore string
+	ignore       string
+
+	// column types used by the schema
+	keyType   string
+	valueType string
+
+	// inlineIndex declares the expires_at index within CREATE TABLE, for
+	// engines which do not support CREATE INDEX IF NOT EXISTS
+	inlineIndex bool
+}
+
+var (
+	Postgres = Dialect{
+		name:         "postgres",
+		bind:         func(n int) string { return "$" + strconv.Itoa(n) },
+		upsert:       "ON CONFLICT (cache_key) DO UPDATE SET cache_value = excluded.cache_value, expires_at = excluded.expires_at",
+		insertIgnore: "INSERT INTO ",
+		ignore:       " ON CONFLICT (cache_key) DO NOTHING",
+		keyType:      "TEXT",
+		valueType:    "BYTEA",
+	}
+
+	SQLite = Dialect{
+		name:         "sqlite",
+		bind:         func(int) string { return "?" },
+		upsert:       "ON CONFLICT (cache_key) DO UPDATE SET cache_value = excluded.cache_value, expires_at = excluded.expires_at",
+		insertIgnore: "INSERT INTO ",
+		ignore:       " ON CONFLICT (cache_key) DO NOTHING",
+		keyType:      "TEXT",
+		valueType:    "BLOB",
+	}
+
+	MySQL = Dialect{
+		name:         "mysql",
+		bind:         func(int) string { return "?" },
+		upsert:       "ON DUPLICATE KEY UPDATE cache_value = VALUES(cache_value), expires_at = VALUES(expires_at)",
+		insertIgnore: "INSERT IGNORE INTO ",
+		ignore:       "",
+		keyType:      "VARCHAR(255)",
+		valueType:    "BLOB",
+		inlineIndex:  true,
+	}
+)
+
+func (d Dialect) String() string {
+	return d.name
+}
+
+// queries are the statements used by a Cache, built for one table and dialect
+type queries struct {
+	get    string
+	put    string
+	add    string
+	delete string
+	expire string
+	prune  string
+}
+
+func (d Dialect) queries(table string) *queries {
+	return &queries{
+		get: "SELECT cache_value FROM " + table +
+			" WHERE cache_key = " + d.bind(1) + " AND expires_at > " + d.bind(2),
+		put: "INSERT INTO " + table + " (cache_key, cache_value, expires_at) VALUES (" +
+			strings.Join([]string{d.bind(1), d.bind(2), d.bind(3)}, ", ") + ") " + d.upsert,
+		add: d.insertIgnore + table + " (cache_key, cache_value, expires_at) VALUES (" +
+			strings.Join([]string{d.bind(1), d.bind(2), d.bind(3)}, ", ") + ")" + d.ignore,
+		delete: "DELETE FROM " + table + " WHERE cache_key = " + d.bind(1),
+		expire: "DELETE FROM " + table + " WHERE cache_key = " + d.bind(1) + " AND expires_at <= " + d.bind(2),
+		prune:  "DELETE FROM " + table + " WHERE expires_at <= " + d.bind(1),
+	}
+}
@@ -0,0 +1,145 @@
+package sqlcache
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+)
+
+// fakeDB is an in-memory stand-in for a database, implementing database/sql
+// driver interfaces for exactly the statements issued by Cache.
+type fakeDB struct {
+	lock       sync.Mutex
+	rows       map[string]fakeRow
+	statements []string
+	fail       error // if set, every statement fails
+}
+
+type fakeRow struct {
+	value   []byte
+	expires int64
+}
+
+func newFakeDB() (*sql.DB, *fakeDB) {
+	f := &fakeDB{rows: make(map[string]fakeRow)}
+	return sql.OpenDB(f), f
+}
+
+func (f *fakeDB) Connect(context.Context) (driver.Conn, error) { return &fakeConn{db: f}, nil }
+func (f *fakeDB) Driver() driver.Driver                        { return nil }
+
+type fakeConn struct {
+	db *fakeDB
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return &fakeStmt{db: c.db, query: strings.TrimSpace(query)}, nil
+}
+
+func (c *fakeConn) Close() error { return nil }
+
+func (c *fakeConn) Begin() (driver.Tx, error) { return nil, errors.New("transactions not supported") }
+
+type fakeStmt struct {
+	db    *fakeDB
+	query string
+}
+
+func (s *fakeStmt) Close() error  { return nil }
+func (s *fakeStmt) NumInput() int { return -1 }
+
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	f := s.db
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	f.statements = append(f.statements, s.query)
+	if f.fail != nil {
+		return nil, f.fail
+	}
+
+	switch {
+	case strings.Contains(s.query, "CREATE"):
+		return driver.RowsAffected(0), nil
+	case strings.HasPrefix(s.query, "INSERT IGNORE"), strings.HasSuffix(s.query, "DO NOTHING"):
+		key := args[0].(string)
+		if _, exists := f.rows[key]; exists {
+			return driver.RowsAffected(0), nil
+		}
+		f.rows[key] = fakeRow{value: args[1].([]byte), expires: args[2].(int64)}
+		return driver.RowsAffected(1), nil
+	case strings.HasPrefix(s.query, "INSERT INTO"):
+		key := args[0].(string)
+		f.rows[key] = fakeRow{value: args[1].([]byte), expires: args[2].(int64)}
+		return driver.RowsAffected(1), nil
+	case strings.Contains(s.query, "WHERE cache_key") && strings.Contains(s.query, "AND expires_at <="):
+		key, now := args[0].(string), args[1].(int64)
+		if row, exists := f.rows[key]; exists && row.expires <= now {
+			delete(f.rows, key)
+			return driver.RowsAffected(1), nil
+		}
+		return driver.RowsAffected(0), nil
+	case strings.Contains(s.query, "WHERE cache_key"):
+		key := args[0].(string)
+		_, exists := f.rows[key]
+		delete(f.rows, key)
+		if exists {
+			return driver.RowsAffected(1), nil
+		}
+		return driver.RowsAffected(0), nil
+	case strings.Contains(s.query, "WHERE expires_at <="):
+		now := args[0].(int64)
+		count := int64(0)
+		for key, row := range f.rows {
+			if row.expires <= now {
+				delete(f.rows, key)
+				count++
+			}
+		}
+		return driver.RowsAffected(count), nil
+	default:
+		return nil, errors.New("unexpected statement: " + s.query)
+	}
+}
+
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	f := s.db
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	f.statements = append(f.statements, s.query)
+	if f.fail != nil {
+		return nil, f.fail
+	}
+
+	if !strings.HasPrefix(s.query, "SELECT cache_value") {
+		return nil, errors.New("unexpected query: " + s.query)
+	}
+
+	key, now := args[0].(string), args[1].(int64)
+	row, exists := f.rows[key]
+	if !exists || row.expires <= now {
+		return &fakeRows{}, nil
+	}
+	return &fakeRows{values: [][]byte{row.value}}, nil
+}
+
+type fakeRows struct {
+	values [][]byte
+}
+
+func (r *fakeRows) Columns() []string { return []string{"cache_value"} }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	dest[0] = r.values[0]
+	r.values = r.values[1:]
+	return nil
+}
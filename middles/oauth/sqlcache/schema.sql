@@ -0,0 +1,12 @@
+-- Table used by sqlcache to store cache items, where the expires_at column is
+-- the unix time in milliseconds at which the item expires.
+CREATE TABLE IF NOT EXISTS {{.Table}} (
+    cache_key   {{.KeyType}} NOT NULL PRIMARY KEY,
+    cache_value {{.ValueType}} NOT NULL,
+    expires_at  BIGINT NOT NULL{{if .InlineIndex}},
+    INDEX {{.Table}}_expires_at (expires_at){{end}}
+);
+{{- if not .InlineIndex}}
+
+CREATE INDEX IF NOT EXISTS {{.Table}}_expires_at ON {{.Table}} (expires_at);
+{{- end}}
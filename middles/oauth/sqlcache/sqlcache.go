@@ -0,0 +1,310 @@
+// Package sqlcache provides an implementation of oauth.Cache backed by a SQL
+// database using database/sql, e.g. Postgres or SQLite.
+//
+// Items are stored in a table with the schema provided by Schema, which can be
+// created by calling Migrate.
+package sqlcache
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	_ "embed"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"cattlecloud.net/go/webtools/middles/oauth"
+)
+
+// ErrTableNotValid indicates the table name is not a plain SQL identifier.
+var ErrTableNotValid = errors.New("sqlcache: table name not valid")
+
+var identifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+//go:embed schema.sql
+var schema string
+
+var schemaTemplate = template.Must(template.New("schema").Parse(schema))
+
+// Schema returns the DDL statements for creating the cache table in the given
+// dialect, for use with an external migration tool.
+func Schema(dialect Dialect, table string) (string, error) {
+	if !identifier.MatchString(table) {
+		return "", ErrTableNotValid
+	}
+
+	var b bytes.Buffer
+	err := schemaTemplate.Execute(&b, map[string]any{
+		"Table":       table,
+		"KeyType":     dialect.keyType,
+		"ValueType":   dialect.valueType,
+		"InlineIndex": dialect.inlineIndex,
+	})
+	return b.String(), err
+}
+
+type Options struct {
+	table   string
+	prune   time.Duration
+	timeout time.Duration
+}
+
+type OptionFunc func(*Options)
+
+// SetTable sets the name of the table used to store items. The default table
+// name is oauth_cache.
+func SetTable(table string) OptionFunc {
+	return func(o *Options) { o.table = table }
+}
+
+// SetPruneInterval sets the interval at which expired rows are deleted from
+// the table. An interval of zero disables pruning.
+func SetPruneInterval(interval time.Duration) OptionFunc {
+	return func(o *Options) { o.prune = interval }
+}
+
+// SetTimeout sets the timeout of operations which are not given a context.
+func SetTimeout(timeout time.Duration) OptionFunc {
+	return func(o *Options) { o.timeout = timeout }
+}
+
+// New creates a Cache backed by the database db, which speaks the given SQL
+// dialect, using codec to encode and decode values.
+//
+// The table must already exist; see Migrate.
+func New[T any](db *sql.DB, dialect Dialect, codec oauth.Codec[T], opts ...OptionFunc) (*Cache[T], error) {
+	options := &Options{
+		table:   "oauth_cache",
+		prune:   10 * time.Minute,
+		timeout: 5 * time.Second,
+	}
+
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	if !identifier.MatchString(options.table) {
+		return nil, ErrTableNotValid
+	}
+
+	c := &Cache[T]{
+		db:      db,
+		dialect: dialect,
+		table:   options.table,
+		queries: dialect.queries(options.table),
+		codec:   codec,
+		timeout: options.timeout,
+		clock:   time.Now,
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+
+	if options.prune > 0 {
+		ticker := time.NewTicker(options.prune)
+		go c.pruner(ticker.C, ticker.Stop)
+	} else {
+		close(c.done)
+	}
+
+	return c, nil
+}
+
+// Cache is an implementation of oauth.Cache backed by a SQL database.
+//
+// Cache implements oauth.ContextCache, oauth.Taker, and oauth.Adder, and
+// operations without a context which fail are treated as cache misses.
+type Cache[T any] struct {
+	db      *sql.DB
+	dialect Dialect
+	table   string
+	queries *queries
+	codec   oauth.Codec[T]
+	timeout time.Duration
+	clock   func() time.Time
+
+	once sync.Once
+	stop chan struct{}
+	done chan struct{}
+}
+
+// Migrate creates the cache table, if it does not already exist.
+func (c *Cache[T]) Migrate(ctx context.Context) error {
+	ddl, err := Schema(c.dialect, c.table)
+	if err != nil {
+		return err
+	}
+
+	// not every driver supports executing many statements at once
+	for statement := range strings.SplitSeq(ddl, ";") {
+		if strings.TrimSpace(statement) == "" {
+			continue
+		}
+		if _, err = c.db.ExecContext(ctx, statement); err != nil {
+			return fmt.Errorf("sqlcache: unable to create table: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (c *Cache[T]) Get(key string) (T, bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	value, exists, _ := c.GetContext(ctx, key)
+	return value, exists
+}
+
+func (c *Cache[T]) Put(key string, value T, ttl time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	_ = c.PutContext(ctx, key, value, ttl)
+}
+
+func (c *Cache[T]) Delete(key string) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	_ = c.DeleteContext(ctx, key)
+}
+
+func (c *Cache[T]) GetContext(ctx context.Context, key string) (T, bool, error) {
+	var (
+		empty T
+		b     []byte
+	)
+
+	now := c.clock().UnixMilli()
+	err := c.db.QueryRowContext(ctx, c.queries.get, key, now).Scan(&b)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return empty, false, nil
+	case err != nil:
+		return empty, false, fmt.Errorf("sqlcache: unable to get item: %w", err)
+	}
+
+	value, err := c.codec.Decode(b)
+	if err != nil {
+		return empty, false, fmt.Errorf("sqlcache: unable to decode value: %w", err)
+	}
+
+	return value, true, nil
+}
+
+func (c *Cache[T]) PutContext(ctx context.Context, key string, value T, ttl time.Duration) error {
+	b, err := c.codec.Encode(value)
+	if err != nil {
+		return fmt.Errorf("sqlcache: unable to encode value: %w", err)
+	}
+
+	expiration := c.clock().Add(ttl).UnixMilli()
+	if _, err = c.db.ExecContext(ctx, c.queries.put, key, b, expiration); err != nil {
+		return fmt.Errorf("sqlcache: unable to put item: %w", err)
+	}
+
+	return nil
+}
+
+func (c *Cache[T]) DeleteContext(ctx context.Context, key string) error {
+	if _, err := c.db.ExecContext(ctx, c.queries.delete, key); err != nil {
+		return fmt.Errorf("sqlcache: unable to delete item: %w", err)
+	}
+	return nil
+}
+
+// Take atomically gets and deletes key. The row is read and then deleted, and
+// only the caller whose delete succeeds receives the item.
+func (c *Cache[T]) Take(ctx context.Context, key string) (T, bool, error) {
+	var empty T
+
+	value, exists, err := c.GetContext(ctx, key)
+	if err != nil || !exists {
+		return empty, false, err
+	}
+
+	result, err := c.db.ExecContext(ctx, c.queries.delete, key)
+	if err != nil {
+		return empty, false, fmt.Errorf("sqlcache: unable to delete item: %w", err)
+	}
+
+	count, err := result.RowsAffected()
+	if err != nil {
+		return empty, false, fmt.Errorf("sqlcache: unable to delete item: %w", err)
+	}
+
+	// another caller deleted the row first
+	if count != 1 {
+		return empty, false, nil
+	}
+
+	return value, true, nil
+}
+
+// Add inserts key only if no unexpired row of key exists. An expired row is
+// deleted first, and then the row is inserted unless another caller inserted
+// it already.
+func (c *Cache[T]) Add(ctx context.Context, key string, value T, ttl time.Duration) (bool, error) {
+	b, err := c.codec.Encode(value)
+	if err != nil {
+		return false, fmt.Errorf("sqlcache: unable to encode value: %w", err)
+	}
+
+	now := c.clock()
+	if _, err = c.db.ExecContext(ctx, c.queries.expire, key, now.UnixMilli()); err != nil {
+		return false, fmt.Errorf("sqlcache: unable to add item: %w", err)
+	}
+
+	result, err := c.db.ExecContext(ctx, c.queries.add, key, b, now.Add(ttl).UnixMilli())
+	if err != nil {
+		return false, fmt.Errorf("sqlcache: unable to add item: %w", err)
+	}
+
+	count, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("sqlcache: unable to add item: %w", err)
+	}
+
+	return count == 1, nil
+}
+
+// Prune deletes expired rows from the table, returning the number of rows
+// deleted.
+func (c *Cache[T]) Prune(ctx context.Context) (int64, error) {
+	now := c.clock().UnixMilli()
+	result, err := c.db.ExecContext(ctx, c.queries.prune, now)
+	if err != nil {
+		return 0, fmt.Errorf("sqlcache: unable to prune items: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+// Close stops the periodic pruning of expired rows. Close does not close the
+// underlying database, and is safe to call more than once.
+func (c *Cache[T]) Close() error {
+	c.once.Do(func() { close(c.stop) })
+	<-c.done
+	return nil
+}
+
+func (c *Cache[T]) pruner(ticks <-chan time.Time, cancel func()) {
+	defer close(c.done)
+	defer cancel()
+
+	for {
+		select {
+		case <-c.stop:
+			return
+		case <-ticks:
+			ctx, stop := context.WithTimeout(context.Background(), c.timeout)
+			// a failed prune is retried on the next tick
+			_, _ = c.Prune(ctx)
+			stop()
+		}
+	}
+}
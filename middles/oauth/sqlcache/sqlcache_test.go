@@ -0,0 +1,236 @@
+package sqlcache
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"cattlecloud.net/go/webtools/middles/oauth"
+	"github.com/shoenig/test/must"
+)
+
+var (
+	_ oauth.Cache[string, int]        = (*Cache[int])(nil)
+	_ oauth.ContextCache[string, int] = (*Cache[int])(nil)
+	_ oauth.Deleter[string]           = (*Cache[int])(nil)
+	_ oauth.Taker[string, int]        = (*Cache[int])(nil)
+	_ oauth.Adder[string, int]        = (*Cache[int])(nil)
+)
+
+func testNow() time.Time {
+	return time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+}
+
+func TestCache_GetPutDelete(t *testing.T) {
+	t.Parallel()
+
+	db, _ := newFakeDB()
+	c, err := New(db, Postgres, oauth.JSONCodec[string]{})
+	must.NoError(t, err)
+	t.Cleanup(func() { _ = c.Close() })
+
+	now := testNow()
+	c.clock = func() time.Time { return now }
+
+	ctx := context.Background()
+	must.NoError(t, c.Migrate(ctx))
+
+	_, exists, gerr := c.GetContext(ctx, "missing")
+	must.NoError(t, gerr)
+	must.False(t, exists)
+
+	must.NoError(t, c.PutContext(ctx, "key", "first", 1*time.Minute))
+	must.NoError(t, c.PutContext(ctx, "key", "second", 1*time.Minute)) // upsert
+	value, exists, gerr := c.GetContext(ctx, "key")
+	must.NoError(t, gerr)
+	must.True(t, exists)
+	must.Eq(t, "second", value)
+
+	// expired rows are not returned
+	now = now.Add(2 * time.Minute)
+	_, exists = c.Get("key")
+	must.False(t, exists)
+
+	now = testNow()
+	c.Delete("key")
+	_, exists = c.Get("key")
+	must.False(t, exists)
+}
+
+func TestCache_Take(t *testing.T) {
+	t.Parallel()
+
+	db, _ := newFakeDB()
+	c, err := New(db, SQLite, oauth.JSONCodec[string]{})
+	must.NoError(t, err)
+	t.Cleanup(func() { _ = c.Close() })
+	c.clock = testNow
+
+	ctx := context.Background()
+	must.NoError(t, c.Migrate(ctx))
+
+	c.Put("key", "hello", 1*time.Minute)
+	value, exists, terr := c.Take(ctx, "key")
+	must.NoError(t, terr)
+	must.True(t, exists)
+	must.Eq(t, "hello", value)
+
+	_, exists, terr = c.Take(ctx, "key")
+	must.NoError(t, terr)
+	must.False(t, exists)
+}
+
+func TestCache_Add(t *testing.T) {
+	t.Parallel()
+
+	db, _ := newFakeDB()
+	c, err := New(db, SQLite, oauth.JSONCodec[string]{})
+	must.NoError(t, err)
+	t.Cleanup(func() { _ = c.Close() })
+	now := testNow()
+	c.clock = func() time.Time { return now }
+
+	ctx := context.Background()
+	must.NoError(t, c.Migrate(ctx))
+
+	added, aerr := c.Add(ctx, "key", "first", 1*time.Minute)
+	must.NoError(t, aerr)
+	must.True(t, added)
+
+	added, aerr = c.Add(ctx, "key", "second", 1*time.Minute)
+	must.NoError(t, aerr)
+	must.False(t, added)
+
+	value, exists := c.Get("key")
+	must.True(t, exists)
+	must.Eq(t, "first", value)
+
+	// an expired row may be added again
+	now = now.Add(2 * time.Minute)
+	added, aerr = c.Add(ctx, "key", "third", 1*time.Minute)
+	must.NoError(t, aerr)
+	must.True(t, added)
+}
+
+func TestCache_Prune(t *testing.T) {
+	t.Parallel()
+
+	db, fake := newFakeDB()
+	c, err := New(db, SQLite, oauth.JSONCodec[int]{}, SetPruneInterval(0))
+	must.NoError(t, err)
+	t.Cleanup(func() { _ = c.Close() })
+
+	now := testNow()
+	c.clock = func() time.Time { return now }
+
+	c.Put("short", 1, 1*time.Minute)
+	c.Put("long", 2, 1*time.Hour)
+
+	now = now.Add(2 * time.Minute)
+	count, perr := c.Prune(context.Background())
+	must.NoError(t, perr)
+	must.Eq(t, 1, count)
+
+	fake.lock.Lock()
+	must.MapContainsKey(t, fake.rows, "long")
+	must.MapNotContainsKey(t, fake.rows, "short")
+	fake.lock.Unlock()
+}
+
+func TestCache_errors(t *testing.T) {
+	t.Parallel()
+
+	db, fake := newFakeDB()
+	fake.fail = errors.New("database is down")
+
+	c, err := New(db, Postgres, oauth.JSONCodec[int]{}, SetPruneInterval(0))
+	must.NoError(t, err)
+	t.Cleanup(func() { _ = c.Close() })
+
+	ctx := context.Background()
+	must.ErrorContains(t, c.PutContext(ctx, "key", 1, time.Minute), "database is down")
+	_, _, gerr := c.GetContext(ctx, "key")
+	must.ErrorContains(t, gerr, "database is down")
+	must.ErrorContains(t, c.DeleteContext(ctx, "key"), "database is down")
+}
+
+func TestNew_table(t *testing.T) {
+	t.Parallel()
+
+	db, fake := newFakeDB()
+
+	_, err := New(db, Postgres, oauth.JSONCodec[int]{}, SetTable("sessions; DROP TABLE users"))
+	must.ErrorIs(t, err, ErrTableNotValid)
+
+	c, err := New(db, Postgres, oauth.JSONCodec[int]{}, SetTable("sessions"), SetPruneInterval(0))
+	must.NoError(t, err)
+	t.Cleanup(func() { _ = c.Close() })
+
+	must.NoError(t, c.Migrate(context.Background()))
+	fake.lock.Lock()
+	must.SliceLen(t, 2, fake.statements)
+	must.StrContains(t, fake.statements[0], "CREATE TABLE IF NOT EXISTS sessions (")
+	must.StrContains(t, fake.statements[1], "CREATE INDEX IF NOT EXISTS sessions_expires_at ON sessions (expires_at)")
+	fake.lock.Unlock()
+}
+
+func TestDialect_queries(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		dialect Dialect
+		put     string
+		get     string
+		add     string
+	}{
+		{
+			dialect: Postgres,
+			get:     "SELECT cache_value FROM t WHERE cache_key = $1 AND expires_at > $2",
+			put:     "INSERT INTO t (cache_key, cache_value, expires_at) VALUES ($1, $2, $3) ON CONFLICT (cache_key) DO UPDATE SET cache_value = excluded.cache_value, expires_at = excluded.expires_at",
+			add:     "INSERT INTO t (cache_key, cache_value, expires_at) VALUES ($1, $2, $3) ON CONFLICT (cache_key) DO NOTHING",
+		},
+		{
+			dialect: SQLite,
+			get:     "SELECT cache_value FROM t WHERE cache_key = ? AND expires_at > ?",
+			put:     "INSERT INTO t (cache_key, cache_value, expires_at) VALUES (?, ?, ?) ON CONFLICT (cache_key) DO UPDATE SET cache_value = excluded.cache_value, expires_at = excluded.expires_at",
+			add:     "INSERT INTO t (cache_key, cache_value, expires_at) VALUES (?, ?, ?) ON CONFLICT (cache_key) DO NOTHING",
+		},
+		{
+			dialect: MySQL,
+			get:     "SELECT cache_value FROM t WHERE cache_key = ? AND expires_at > ?",
+			put:     "INSERT INTO t (cache_key, cache_value, expires_at) VALUES (?, ?, ?) ON DUPLICATE KEY UPDATE cache_value = VALUES(cache_value), expires_at = VALUES(expires_at)",
+			add:     "INSERT IGNORE INTO t (cache_key, cache_value, expires_at) VALUES (?, ?, ?)",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.dialect.String(), func(t *testing.T) {
+			q := tc.dialect.queries("t")
+			must.Eq(t, tc.get, q.get)
+			must.Eq(t, tc.put, q.put)
+			must.Eq(t, tc.add, q.add)
+		})
+	}
+}
+
+func TestSchema(t *testing.T) {
+	t.Parallel()
+
+	ddl, err := Schema(MySQL, "sessions")
+	must.NoError(t, err)
+	must.StrContains(t, ddl, "cache_key   VARCHAR(255) NOT NULL PRIMARY KEY")
+
+	// mysql has no CREATE INDEX IF NOT EXISTS, so the index is declared with
+	// the table to allow migrating more than once
+	must.StrContains(t, ddl, "expires_at  BIGINT NOT NULL,\n    INDEX sessions_expires_at (expires_at)\n);")
+	must.StrNotContains(t, ddl, "CREATE INDEX")
+
+	ddl, err = Schema(SQLite, "sessions")
+	must.NoError(t, err)
+	must.StrContains(t, ddl, "expires_at  BIGINT NOT NULL\n);")
+	must.StrContains(t, ddl, "CREATE INDEX IF NOT EXISTS sessions_expires_at ON sessions (expires_at);")
+
+	_, err = Schema(MySQL, "1sessions")
+	must.ErrorIs(t, err, ErrTableNotValid)
+}
@@ -0,0 +1,205 @@
+package oauth
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// TieredOption is used to configure optional behavior of a TieredCache.
+type TieredOption func(*tieredOptions)
+
+type tieredOptions struct {
+	localTTL    time.Duration
+	negativeTTL time.Duration
+	onDelete    func(string)
+}
+
+// LocalTTL sets how long an item is kept in the local tier of a TieredCache,
+// bounding how stale an item may be relative to the remote tier. The default
+// is 30 seconds.
+func LocalTTL(ttl time.Duration) TieredOption {
+	return func(o *tieredOptions) { o.localTTL = ttl }
+}
+
+// NegativeTTL sets how long a miss in the remote tier of a TieredCache is
+// remembered, during which the remote tier is not consulted for the same key.
+// The default is 5 seconds; a ttl of zero disables negative caching.
+func NegativeTTL(ttl time.Duration) TieredOption {
+	return func(o *tieredOptions) { o.negativeTTL = ttl }
+}
+
+// NotifyDelete sets a function called with the key of each item deleted from
+// a TieredCache, e.g. for broadcasting to other processes which must then call
+// Invalidate on their own TieredCache.
+func NotifyDelete(f func(key string)) TieredOption {
+	return func(o *tieredOptions) { o.onDelete = f }
+}
+
+// NewTieredCache creates a TieredCache, where a VolatileCache holding at most
+// size items is layered in front of the remote Cache.
+func NewTieredCache[T any](remote Cache[string, T], size int, opts ...TieredOption) *TieredCache[T] {
+	options := &tieredOptions{
+		localTTL:    30 * time.Second,
+		negativeTTL: 5 * time.Second,
+		onDelete:    func(string) {},
+	}
+
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	return &TieredCache[T]{
+		remote:      remote,
+		local:       NewVolatileCache[T](size),
+		misses:      NewVolatileCache[struct{}](size),
+		localTTL:    options.localTTL,
+		negativeTTL: options.negativeTTL,
+		onDelete:    options.onDelete,
+		generations: make(map[string]uint64),
+	}
+}
+
+// TieredCache is an implementation of Cache which layers a small in-memory
+// cache in front of a remote Cache (e.g. redis), such that repeated lookups of
+// the same key do not require a network round trip.
+//
+// Concurrent misses of the same key in the local tier result in one lookup in
+// the remote tier, and misses in the remote tier are also remembered for a
+// short time.
+//
+// Items deleted from one TieredCache may remain in the local tier of other
+// processes for up to the local TTL, unless their Invalidate is called.
+type TieredCache[T any] struct {
+	remote Cache[string, T]
+	local  *VolatileCache[T]
+	misses *VolatileCache[struct{}]
+	flight flight[T]
+
+	localTTL    time.Duration
+	negativeTTL time.Duration
+	onDelete    func(string)
+
+	// lock guards generations, which counts the invalidations of each key
+	// being read from the remote tier, such that a read which began before an
+	// invalidation does not fill the local tier with the invalidated item
+	lock        sync.Mutex
+	generations map[string]uint64
+}
+
+func (tc *TieredCache[T]) Get(key string) (T, bool) {
+	value, exists, _ := tc.GetContext(context.Background(), key)
+	return value, exists
+}
+
+func (tc *TieredCache[T]) Put(key string, value T, ttl time.Duration) {
+	_ = tc.PutContext(context.Background(), key, value, ttl)
+}
+
+// Delete the item of key from both tiers.
+func (tc *TieredCache[T]) Delete(key string) {
+	_ = tc.DeleteContext(context.Background(), key)
+}
+
+func (tc *TieredCache[T]) GetContext(ctx context.Context, key string) (T, bool, error) {
+	if value, exists := tc.local.Get(key); exists {
+		return value, true, nil
+	}
+
+	if _, missed := tc.misses.Get(key); missed {
+		var empty T
+		return empty, false, nil
+	}
+
+	return tc.flight.do(ctx, key, func(ctx context.Context) (T, bool, error) {
+		generation := tc.begin(key)
+		value, exists, err := Get(ctx, tc.remote, key)
+
+		tc.lock.Lock()
+		defer tc.lock.Unlock()
+
+		switch {
+		case !tc.end(key, generation):
+			// invalidated during the read; the item may already be stale
+		case err != nil:
+			// do not remember failures
+		case exists:
+			tc.local.Put(key, value, tc.localTTL)
+		case tc.negativeTTL > 0:
+			tc.misses.Put(key, struct{}{}, tc.negativeTTL)
+		}
+		return value, exists, err
+	})
+}
+
+// begin a read of key from the remote tier, returning the generation of key
+func (tc *TieredCache[T]) begin(key string) uint64 {
+	tc.lock.Lock()
+	defer tc.lock.Unlock()
+
+	if _, exists := tc.generations[key]; !exists {
+		tc.generations[key] = 0
+	}
+	return tc.generations[key]
+}
+
+// end a read of key from the remote tier, returning whether key has not been
+// invalidated since the read began; the lock must be held
+func (tc *TieredCache[T]) end(key string, generation uint64) bool {
+	current := tc.generations[key]
+	delete(tc.generations, key)
+	return current == generation
+}
+
+// invalidate removes key from the local tier, and from any read of key from
+// the remote tier in flight; the lock must be held
+func (tc *TieredCache[T]) invalidate(key string) {
+	if generation, exists := tc.generations[key]; exists {
+		tc.generations[key] = generation + 1
+	}
+	tc.local.Delete(key)
+	tc.misses.Delete(key)
+}
+
+func (tc *TieredCache[T]) PutContext(ctx context.Context, key string, value T, ttl time.Duration) error {
+	err := Put(ctx, tc.remote, key, value, ttl)
+
+	tc.lock.Lock()
+	defer tc.lock.Unlock()
+
+	tc.invalidate(key)
+	if err != nil {
+		return err
+	}
+	tc.local.Put(key, value, min(ttl, tc.localTTL))
+	return nil
+}
+
+func (tc *TieredCache[T]) DeleteContext(ctx context.Context, key string) error {
+	tc.Invalidate(key)
+	err := Delete(ctx, tc.remote, key)
+
+	// lookups which read the item before it was deleted must not fill the
+	// local tier
+	tc.Invalidate(key)
+
+	if err != nil {
+		return err
+	}
+	tc.onDelete(key)
+	return nil
+}
+
+// Invalidate removes keys from the local tier only, such that the next lookup
+// of each key consults the remote tier.
+//
+// A lookup of a key from the remote tier which is in flight when the key is
+// invalidated does not fill the local tier.
+func (tc *TieredCache[T]) Invalidate(keys ...string) {
+	tc.lock.Lock()
+	defer tc.lock.Unlock()
+
+	for _, key := range keys {
+		tc.invalidate(key)
+	}
+}
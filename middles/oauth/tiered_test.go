@@ -0,0 +1,244 @@
+package oauth
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/shoenig/test/must"
+)
+
+var (
+	_ Cache[string, int]        = (*TieredCache[int])(nil)
+	_ ContextCache[string, int] = (*TieredCache[int])(nil)
+)
+
+// remoteCache counts lookups, and optionally blocks them after reading the
+// item until released
+type remoteCache struct {
+	*VolatileCache[int]
+	gets    atomic.Int64
+	release chan struct{}
+}
+
+func newRemoteCache() *remoteCache {
+	return &remoteCache{VolatileCache: NewVolatileCache[int](size)}
+}
+
+func (rc *remoteCache) Get(key string) (int, bool) {
+	value, exists := rc.VolatileCache.Get(key)
+	rc.gets.Add(1)
+	if rc.release != nil {
+		<-rc.release
+	}
+	return value, exists
+}
+
+func TestTieredCache_local(t *testing.T) {
+	t.Parallel()
+
+	remote := newRemoteCache()
+	tc := NewTieredCache[int](remote, size)
+
+	tc.Put("a", 1, 1*time.Hour)
+
+	// served by the local tier
+	for range 3 {
+		value, ok := tc.Get("a")
+		must.True(t, ok)
+		must.Eq(t, 1, value)
+	}
+	must.Eq(t, 0, remote.gets.Load())
+
+	// after invalidation, served by the remote tier, then the local tier
+	tc.Invalidate("a")
+	for range 3 {
+		value, ok := tc.Get("a")
+		must.True(t, ok)
+		must.Eq(t, 1, value)
+	}
+	must.Eq(t, 1, remote.gets.Load())
+}
+
+func TestTieredCache_localTTL(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	remote := newRemoteCache()
+	tc := NewTieredCache[int](remote, size, LocalTTL(1*time.Second))
+	tc.local.clock = func() time.Time { return now }
+
+	remote.Put("a", 1, 1*time.Hour)
+	_, _ = tc.Get("a")
+	_, _ = tc.Get("a")
+	must.Eq(t, 1, remote.gets.Load())
+
+	// local copy expires
+	now = now.Add(2 * time.Second)
+	_, _ = tc.Get("a")
+	must.Eq(t, 2, remote.gets.Load())
+}
+
+func TestTieredCache_negative(t *testing.T) {
+	t.Parallel()
+
+	t.Run("enabled", func(t *testing.T) {
+		remote := newRemoteCache()
+		tc := NewTieredCache[int](remote, size)
+
+		for range 3 {
+			_, ok := tc.Get("missing")
+			must.False(t, ok)
+		}
+		must.Eq(t, 1, remote.gets.Load())
+
+		// a put clears the negative entry
+		tc.Put("missing", 1, 1*time.Hour)
+		_, ok := tc.Get("missing")
+		must.True(t, ok)
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		remote := newRemoteCache()
+		tc := NewTieredCache[int](remote, size, NegativeTTL(0))
+
+		for range 3 {
+			_, ok := tc.Get("missing")
+			must.False(t, ok)
+		}
+		must.Eq(t, 3, remote.gets.Load())
+	})
+}
+
+func TestTieredCache_singleflight(t *testing.T) {
+	t.Parallel()
+
+	remote := newRemoteCache()
+	remote.Put("a", 1, 1*time.Hour)
+	remote.release = make(chan struct{})
+	tc := NewTieredCache[int](remote, size)
+
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Go(func() {
+			value, ok := tc.Get("a")
+			must.True(t, ok)
+			must.Eq(t, 1, value)
+		})
+	}
+
+	// wait for the first lookup to reach the remote tier, then release it
+	for remote.gets.Load() == 0 {
+		time.Sleep(1 * time.Millisecond)
+	}
+	time.Sleep(10 * time.Millisecond) // let the others pile up
+	close(remote.release)
+	wg.Wait()
+
+	must.Eq(t, 1, remote.gets.Load())
+}
+
+func TestTieredCache_Delete(t *testing.T) {
+	t.Parallel()
+
+	var notified []string
+	remote := newRemoteCache()
+	tc := NewTieredCache[int](remote, size, NotifyDelete(func(key string) {
+		notified = append(notified, key)
+	}))
+
+	tc.Put("a", 1, 1*time.Hour)
+	must.NoError(t, tc.DeleteContext(context.Background(), "a"))
+
+	_, ok := tc.Get("a")
+	must.False(t, ok)
+	_, ok = remote.VolatileCache.Get("a")
+	must.False(t, ok)
+	must.Eq(t, []string{"a"}, notified)
+}
+
+func TestTieredCache_invalidateInFlight(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]func(*TieredCache[int]){
+		"delete": func(tc *TieredCache[int]) {
+			must.NoError(t, tc.DeleteContext(context.Background(), "s"))
+		},
+		"invalidate": func(tc *TieredCache[int]) {
+			tc.Invalidate("s")
+		},
+	}
+
+	for name, revoke := range cases {
+		t.Run(name, func(t *testing.T) {
+			remote := newRemoteCache()
+			remote.Put("s", 1, 1*time.Hour)
+			remote.release = make(chan struct{})
+			tc := NewTieredCache[int](remote, size)
+
+			// a lookup reads the item from the remote tier, and is held
+			// before filling the local tier
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				value, ok := tc.Get("s")
+				must.True(t, ok)
+				must.Eq(t, 1, value)
+			}()
+			for remote.gets.Load() == 0 {
+				time.Sleep(1 * time.Millisecond)
+			}
+
+			revoke(tc)
+			close(remote.release)
+			<-done
+
+			// the lookup in flight did not fill the local tier
+			_, ok := tc.local.Get("s")
+			must.False(t, ok)
+
+			if name == "delete" {
+				_, ok = tc.Get("s")
+				must.False(t, ok)
+			}
+		})
+	}
+}
+
+func TestTieredCache_cancelled(t *testing.T) {
+	t.Parallel()
+
+	remote := newRemoteCache()
+	remote.Put("a", 1, 1*time.Hour)
+	remote.release = make(chan struct{})
+	tc := NewTieredCache[int](remote, size)
+
+	// the first lookup goes away while the remote tier is being read
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan error)
+	go func() {
+		_, _, err := tc.GetContext(ctx, "a")
+		first <- err
+	}()
+	for remote.gets.Load() == 0 {
+		time.Sleep(1 * time.Millisecond)
+	}
+
+	second := make(chan int)
+	go func() {
+		value, ok, err := tc.GetContext(context.Background(), "a")
+		must.NoError(t, err)
+		must.True(t, ok)
+		second <- value
+	}()
+
+	cancel()
+	must.ErrorIs(t, <-first, context.Canceled)
+
+	// the other lookup still gets the item
+	close(remote.release)
+	must.Eq(t, 1, <-second)
+	must.Eq(t, 1, remote.gets.Load())
+}
@@ -1,22 +1,88 @@
 package oauth
 
 import (
+	"container/list"
+	"context"
+	"iter"
 	"sync"
 	"time"
 )
 
 type item[T any] struct {
+	key        string
 	value      T
 	expiration time.Time
 }
 
+// VolatileOption is used to configure optional behavior of a VolatileCache.
+type VolatileOption func(*volatileOptions)
+
+type volatileOptions struct {
+	interval time.Duration
+	snapshot time.Duration
+	clock    func() time.Time
+	ticker   func(time.Duration) (<-chan time.Time, func())
+}
+
+// SweepEvery enables a background goroutine which purges expired items from
+// the cache at each interval. The goroutine is stopped by calling Close.
+func SweepEvery(interval time.Duration) VolatileOption {
+	return func(o *volatileOptions) { o.interval = interval }
+}
+
+// Clock sets the source of the current time of the cache, by which items are
+// expired. The default is time.Now.
+func Clock(now func() time.Time) VolatileOption {
+	return func(o *volatileOptions) { o.clock = now }
+}
+
+func newVolatileOptions(opts []VolatileOption) *volatileOptions {
+	options := &volatileOptions{
+		snapshot: 1 * time.Minute,
+		clock:    time.Now,
+		ticker:   newTicker,
+	}
+
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	return options
+}
+
 // NewVolatileCache creates an in-memory implementation of Cache.
-func NewVolatileCache[T any](size int) *VolatileCache[T] {
-	return &VolatileCache[T]{
+//
+// The cache holds at most size items, evicting the least recently used item
+// to make room for new items once full. A size of zero or less means the cache
+// is unbounded.
+func NewVolatileCache[T any](size int, opts ...VolatileOption) *VolatileCache[T] {
+	return newVolatileCache[T](size, newVolatileOptions(opts))
+}
+
+func newVolatileCache[T any](size int, options *volatileOptions) *VolatileCache[T] {
+	vc := &VolatileCache[T]{
 		lock:  new(sync.Mutex),
-		data:  make(map[string]*item[T], size),
-		clock: time.Now,
+		size:  size,
+		data:  make(map[string]*list.Element, max(size, 0)),
+		order: list.New(),
+		clock: options.clock,
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
 	}
+
+	if options.interval > 0 {
+		ticks, cancel := options.ticker(options.interval)
+		go vc.janitor(ticks, cancel)
+	} else {
+		close(vc.done)
+	}
+
+	return vc
+}
+
+func newTicker(interval time.Duration) (<-chan time.Time, func()) {
+	ticker := time.NewTicker(interval)
+	return ticker.C, ticker.Stop
 }
 
 // VolatileCache is an in-memory implementation of Cache.
@@ -25,13 +91,20 @@ func NewVolatileCache[T any](size int) *VolatileCache[T] {
 // so implies that any process restart will cause all sessions to be wiped out.
 // Most services should make use of memcached, redis, etc.
 //
-// Additionally this implementation does not purge old sessions; expired
-// sessions linger forever if never accessed again. A better in-memory cache
-// would make use of an LRU.
+// Expired items are purged when accessed, when evicted as the least recently
+// used item once the cache is full, or periodically if SweepEvery is set.
 type VolatileCache[T any] struct {
 	lock  *sync.Mutex
-	data  map[string]*item[T]
+	size  int
+	data  map[string]*list.Element // of *item[T]
+	order *list.List               // front is most recently used
 	clock func() time.Time
+
+	observers []func(Event)
+
+	once sync.Once
+	stop chan struct{}
+	done chan struct{}
 }
 
 func (vc *VolatileCache[T]) Get(path string) (T, bool) {
@@ -40,7 +113,7 @@ func (vc *VolatileCache[T]) Get(path string) (T, bool) {
 	vc.lock.Lock()
 	defer vc.lock.Unlock()
 
-	item, exists := vc.data[path]
+	element, exists := vc.data[path]
 
 	// check item was in the cache
 	if !exists {
@@ -49,12 +122,16 @@ func (vc *VolatileCache[T]) Get(path string) (T, bool) {
 	}
 
 	// check item expiration and purge if necessary
+	item := element.Value.(*item[T])
 	if now.After(item.expiration) {
-		delete(vc.data, path)
+		vc.remove(element, EventExpire)
 		var empty T
 		return empty, false
 	}
 
+	// mark item as most recently used
+	vc.order.MoveToFront(element)
+
 	return item.value, exists
 }
 
@@ -64,9 +141,203 @@ func (vc *VolatileCache[T]) Put(path string, value T, ttl time.Duration) {
 	vc.lock.Lock()
 	defer vc.lock.Unlock()
 
+	// replace the value if the item already exists
+	if element, exists := vc.data[path]; exists {
+		element.Value = &item[T]{
+			key:        path,
+			expiration: now.Add(ttl),
+			value:      value,
+		}
+		vc.order.MoveToFront(element)
+		return
+	}
+
+	// make room for the new item if necessary
+	if vc.size > 0 && vc.order.Len() >= vc.size {
+		vc.remove(vc.order.Back(), EventEvict)
+	}
+
 	// store the value
-	vc.data[path] = &item[T]{
+	vc.data[path] = vc.order.PushFront(&item[T]{
+		key:        path,
 		expiration: now.Add(ttl),
 		value:      value,
+	})
+}
+
+// Delete the item of path from the cache, if it exists.
+func (vc *VolatileCache[T]) Delete(path string) {
+	vc.lock.Lock()
+	defer vc.lock.Unlock()
+
+	if element, exists := vc.data[path]; exists {
+		vc.remove(element, EventDelete)
+	}
+}
+
+// Take atomically gets and deletes the item of path from the cache.
+func (vc *VolatileCache[T]) Take(_ context.Context, path string) (T, bool, error) {
+	now := vc.clock()
+
+	vc.lock.Lock()
+	defer vc.lock.Unlock()
+
+	var empty T
+
+	element, exists := vc.data[path]
+	if !exists {
+		return empty, false, nil
+	}
+
+	item := element.Value.(*item[T])
+	if now.After(item.expiration) {
+		vc.remove(element, EventExpire)
+		return empty, false, nil
+	}
+
+	vc.remove(element, EventDelete)
+	return item.value, true, nil
+}
+
+// Add puts the item of path into the cache only if no unexpired item of path
+// exists, returning whether the item was put.
+func (vc *VolatileCache[T]) Add(_ context.Context, path string, value T, ttl time.Duration) (bool, error) {
+	now := vc.clock()
+
+	vc.lock.Lock()
+	defer vc.lock.Unlock()
+
+	if element, exists := vc.data[path]; exists {
+		if !now.After(element.Value.(*item[T]).expiration) {
+			return false, nil
+		}
+		vc.remove(element, EventExpire)
+	}
+
+	// make room for the new item if necessary
+	if vc.size > 0 && vc.order.Len() >= vc.size {
+		vc.remove(vc.order.Back(), EventEvict)
+	}
+
+	vc.data[path] = vc.order.PushFront(&item[T]{
+		key:        path,
+		expiration: now.Add(ttl),
+		value:      value,
+	})
+	return true, nil
+}
+
+// Len returns the number of unexpired items in the cache.
+func (vc *VolatileCache[T]) Len() int {
+	now := vc.clock()
+
+	vc.lock.Lock()
+	defer vc.lock.Unlock()
+
+	count := 0
+	for element := vc.order.Front(); element != nil; element = element.Next() {
+		if !now.After(element.Value.(*item[T]).expiration) {
+			count++
+		}
+	}
+	return count
+}
+
+// All returns an iterator over the unexpired items in the cache, from most to
+// least recently used. The iterator operates on a snapshot of the cache, and
+// does not affect the recency of items.
+func (vc *VolatileCache[T]) All() iter.Seq2[string, T] {
+	items := vc.live()
+	return func(yield func(string, T) bool) {
+		for _, item := range items {
+			if !yield(item.key, item.value) {
+				return
+			}
+		}
+	}
+}
+
+// live returns a snapshot of the unexpired items in the cache, from most to
+// least recently used
+func (vc *VolatileCache[T]) live() []*item[T] {
+	now := vc.clock()
+
+	vc.lock.Lock()
+	defer vc.lock.Unlock()
+
+	items := make([]*item[T], 0, vc.order.Len())
+	for element := vc.order.Front(); element != nil; element = element.Next() {
+		if item := element.Value.(*item[T]); !now.After(item.expiration) {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// restore an item into the cache as the most recently used item, unless the
+// item is already expired
+func (vc *VolatileCache[T]) restore(path string, value T, expiration time.Time) {
+	ttl := expiration.Sub(vc.clock())
+	if ttl < 0 {
+		return
+	}
+	vc.Put(path, value, ttl)
+}
+
+// remove element from the cache; the lock must be held
+func (vc *VolatileCache[T]) remove(element *list.Element, event Event) {
+	item := vc.order.Remove(element).(*item[T])
+	delete(vc.data, item.key)
+	if event != EventDelete {
+		for _, observer := range vc.observers {
+			observer(event)
+		}
+	}
+}
+
+// Observe adds f to be called when an item is purged because it expired, or
+// is evicted to make room for another item. f is called while the cache is
+// locked, and must not call back into the cache.
+func (vc *VolatileCache[T]) Observe(f func(Event)) {
+	vc.lock.Lock()
+	defer vc.lock.Unlock()
+	vc.observers = append(vc.observers, f)
+}
+
+// Close stops the background sweeper goroutine, if any, waiting for it to
+// exit. Close is safe to call more than once.
+func (vc *VolatileCache[T]) Close() error {
+	vc.once.Do(func() { close(vc.stop) })
+	<-vc.done
+	return nil
+}
+
+func (vc *VolatileCache[T]) janitor(ticks <-chan time.Time, cancel func()) {
+	defer close(vc.done)
+	defer cancel()
+
+	for {
+		select {
+		case <-vc.stop:
+			return
+		case <-ticks:
+			vc.sweep()
+		}
+	}
+}
+
+// sweep purges every expired item from the cache
+func (vc *VolatileCache[T]) sweep() {
+	now := vc.clock()
+
+	vc.lock.Lock()
+	defer vc.lock.Unlock()
+
+	for element := vc.order.Back(); element != nil; {
+		previous := element.Prev()
+		if now.After(element.Value.(*item[T]).expiration) {
+			vc.remove(element, EventExpire)
+		}
+		element = previous
 	}
 }
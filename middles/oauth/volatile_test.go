@@ -1,10 +1,14 @@
 package oauth
 
 import (
+	"context"
+	"strconv"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/shoenig/test/must"
+	"github.com/shoenig/test/wait"
 )
 
 const size = 10
@@ -69,3 +73,209 @@ func TestVolatileCache_Put(t *testing.T) {
 		must.Eq(t, 2, val)
 	})
 }
+
+func TestVolatileCache_Evict(t *testing.T) {
+	t.Parallel()
+
+	t.Run("least recently put", func(t *testing.T) {
+		vc := NewVolatileCache[int](2)
+
+		vc.Put("a", 1, 1*time.Minute)
+		vc.Put("b", 2, 1*time.Minute)
+		vc.Put("c", 3, 1*time.Minute)
+
+		_, ok := vc.Get("a")
+		must.False(t, ok)
+		must.MapLen(t, 2, vc.data)
+	})
+
+	t.Run("get updates recency", func(t *testing.T) {
+		vc := NewVolatileCache[int](2)
+
+		vc.Put("a", 1, 1*time.Minute)
+		vc.Put("b", 2, 1*time.Minute)
+		_, _ = vc.Get("a")
+		vc.Put("c", 3, 1*time.Minute)
+
+		_, ok := vc.Get("a")
+		must.True(t, ok)
+		_, ok = vc.Get("b")
+		must.False(t, ok)
+	})
+
+	t.Run("overwrite does not evict", func(t *testing.T) {
+		vc := NewVolatileCache[int](2)
+
+		vc.Put("a", 1, 1*time.Minute)
+		vc.Put("b", 2, 1*time.Minute)
+		vc.Put("a", 3, 1*time.Minute)
+
+		_, ok := vc.Get("b")
+		must.True(t, ok)
+		must.MapLen(t, 2, vc.data)
+	})
+
+	t.Run("unbounded", func(t *testing.T) {
+		vc := NewVolatileCache[int](0)
+
+		for i := range 100 {
+			vc.Put(strconv.Itoa(i), i, 1*time.Minute)
+		}
+		must.MapLen(t, 100, vc.data)
+	})
+}
+
+func TestVolatileCache_Sweep(t *testing.T) {
+	t.Parallel()
+
+	// control both the clock and the ticks of the sweeper
+	lock := new(sync.Mutex)
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	ticks := make(chan time.Time)
+	stopped := false
+
+	vc := newVolatileCache[string](size, &volatileOptions{
+		interval: 1 * time.Minute,
+		clock: func() time.Time {
+			lock.Lock()
+			defer lock.Unlock()
+			return now
+		},
+		ticker: func(time.Duration) (<-chan time.Time, func()) {
+			return ticks, func() { stopped = true }
+		},
+	})
+
+	vc.Put("short", "a", 1*time.Minute)
+	vc.Put("long", "b", 1*time.Hour)
+
+	// advance clock beyond the first ttl and trigger a sweep
+	lock.Lock()
+	now = now.Add(2 * time.Minute)
+	lock.Unlock()
+	ticks <- now
+	ticks <- now // blocks until the first sweep is complete
+
+	vc.lock.Lock()
+	_, shortExists := vc.data["short"]
+	_, longExists := vc.data["long"]
+	vc.lock.Unlock()
+	must.False(t, shortExists)
+	must.True(t, longExists)
+
+	must.NoError(t, vc.Close())
+	must.True(t, stopped)
+
+	// closing again is fine
+	must.NoError(t, vc.Close())
+}
+
+func TestVolatileCache_Close(t *testing.T) {
+	t.Parallel()
+
+	// no sweeper
+	vc := NewVolatileCache[string](size)
+	must.NoError(t, vc.Close())
+
+	// real sweeper
+	vc2 := NewVolatileCache[string](size, SweepEvery(1*time.Millisecond))
+	vc2.Put("key", "value", 1*time.Millisecond)
+	must.Wait(t, wait.InitialSuccess(
+		wait.BoolFunc(func() bool {
+			vc2.lock.Lock()
+			defer vc2.lock.Unlock()
+			return len(vc2.data) == 0
+		}),
+		wait.Timeout(5*time.Second),
+		wait.Gap(1*time.Millisecond),
+	))
+	must.NoError(t, vc2.Close())
+}
+
+func TestVolatileCache_Delete(t *testing.T) {
+	t.Parallel()
+
+	vc := NewVolatileCache[int](size)
+	vc.Put("a", 1, 1*time.Minute)
+	vc.Delete("a")
+	vc.Delete("b") // does not exist
+
+	_, ok := vc.Get("a")
+	must.False(t, ok)
+	must.MapEmpty(t, vc.data)
+}
+
+func TestVolatileCache_Take(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	vc := NewVolatileCache[int](size)
+	vc.clock = func() time.Time { return now }
+
+	vc.Put("a", 1, 1*time.Minute)
+	vc.Put("b", 2, 1*time.Hour)
+
+	value, ok, err := vc.Take(context.Background(), "b")
+	must.NoError(t, err)
+	must.True(t, ok)
+	must.Eq(t, 2, value)
+
+	_, ok, _ = vc.Take(context.Background(), "b")
+	must.False(t, ok)
+
+	// advance clock beyond the ttl of a
+	now = now.Add(2 * time.Minute)
+	_, ok, _ = vc.Take(context.Background(), "a")
+	must.False(t, ok)
+	must.MapEmpty(t, vc.data)
+}
+
+func TestVolatileCache_Add(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	vc := NewVolatileCache[int](size)
+	vc.clock = func() time.Time { return now }
+	ctx := context.Background()
+
+	added, err := vc.Add(ctx, "a", 1, 1*time.Minute)
+	must.NoError(t, err)
+	must.True(t, added)
+
+	added, _ = vc.Add(ctx, "a", 2, 1*time.Minute)
+	must.False(t, added)
+
+	value, _ := vc.Get("a")
+	must.Eq(t, 1, value)
+
+	// advance clock beyond the ttl of a
+	now = now.Add(2 * time.Minute)
+	added, _ = vc.Add(ctx, "a", 3, 1*time.Minute)
+	must.True(t, added)
+
+	value, _ = vc.Get("a")
+	must.Eq(t, 3, value)
+}
+
+func TestVolatileCache_LenAll(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	vc := NewVolatileCache[int](size)
+	vc.clock = func() time.Time { return now }
+
+	vc.Put("a", 1, 1*time.Minute)
+	vc.Put("b", 2, 1*time.Hour)
+	vc.Put("c", 3, 1*time.Hour)
+
+	// advance clock beyond the ttl of a
+	now = now.Add(2 * time.Minute)
+
+	must.Eq(t, 2, vc.Len())
+
+	result := make(map[string]int)
+	for k, v := range vc.All() {
+		result[k] = v
+	}
+	must.MapEq(t, map[string]int{"b": 2, "c": 3}, result)
+}
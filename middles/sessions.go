@@ -76,7 +76,7 @@ func (ss *SetSession[D, I]) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// we found a matching token; we can allow the session
-	live := &session[I]{id: data.Identity(), active: true}
+	live := &session[I]{id: data.Identity(), token: data.Token(), active: true}
 	ctx2 := context.WithValue(r.Context(), sessionContextKey, live)
 	r2 := r.WithContext(ctx2)
 
@@ -87,6 +87,7 @@ func (ss *SetSession[D, I]) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 // allowing an identity based session to be recognized as active or not.
 type session[I identity.UserIdentity] struct {
 	id     I
+	token  *conceal.Text
 	active bool
 }
 